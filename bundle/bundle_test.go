@@ -1,12 +1,15 @@
 package bundle_test
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 	"tidbyt.dev/pixlet/bundle"
+	"tidbyt.dev/pixlet/runtime"
 )
 
 func TestBundleWriteAndLoad(t *testing.T) {
@@ -87,6 +90,60 @@ func TestBundleWriteAndLoadWithoutRuntime(t *testing.T) {
 		_, err := newBun.Source.Open(file)
 		assert.NoError(t, err)
 	}
+
+	// Ensure local secrets and the keys they refer to are never bundled.
+	for _, file := range []string{
+		"pixlet.secrets.yaml",
+		"keys/app.keyset.json",
+		"keys/kek.json",
+	} {
+		_, err = newBun.Source.Open(file)
+		assert.ErrorIs(t, err, os.ErrNotExist, file)
+	}
+}
+
+func TestBundleWriteRefusesSecretFiles(t *testing.T) {
+	manifestYAML, err := os.ReadFile("testdata/testapp/manifest.yaml")
+	assert.NoError(t, err)
+	secrets, err := os.ReadFile("testdata/testapp/pixlet.secrets.yaml")
+	assert.NoError(t, err)
+
+	// secrets under another name are neither bundled nor silently dropped
+	ab, err := bundle.FromFS(fstest.MapFS{
+		"manifest.yaml":      {Data: manifestYAML},
+		"config/secrets.yml": {Data: secrets},
+	})
+	assert.NoError(t, err)
+
+	err = ab.WriteBundle(&bytes.Buffer{}, bundle.WithoutRuntime())
+	assert.ErrorContains(t, err, "config/secrets.yml")
+}
+
+func TestBundleWriteAndLoadWithLibraries(t *testing.T) {
+	ab, err := bundle.FromDir("testdata/libapp")
+	assert.NoError(t, err)
+
+	// Without the library path, the app can't be loaded.
+	buf := &bytes.Buffer{}
+	err = ab.WriteBundle(buf)
+	assert.ErrorContains(t, err, "@teamlib/greeting.star")
+
+	// Library files are written to the bundle alongside the app.
+	buf.Reset()
+	err = ab.WriteBundle(buf, bundle.WithLibraryPath([]string{"testdata/libraries"}))
+	assert.NoError(t, err)
+
+	newBun, err := bundle.LoadBundle(buf)
+	assert.NoError(t, err)
+
+	_, err = newBun.Source.Open("@teamlib/greeting.star")
+	assert.NoError(t, err)
+	_, err = newBun.Source.Open("@teamlib/unused.star")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// The bundle is self-contained.
+	_, err = runtime.NewAppletFromFS("lib-app", newBun.Source)
+	assert.NoError(t, err)
 }
 
 func TestLoadBundle(t *testing.T) {
@@ -32,6 +32,18 @@ func WithoutRuntime() WriteOption {
 	return withoutRuntimeOption{}
 }
 
+type withLibraryPathOption struct {
+	path []string
+}
+
+// WithLibraryPath is a WriteOption that makes the shared libraries in the
+// directories on path available to the app, as runtime.WithLibraryPath does.
+// The library files that the app loads are written to the bundle, so that it
+// doesn't depend on the library path when loaded again.
+func WithLibraryPath(path []string) WriteOption {
+	return &withLibraryPathOption{path: path}
+}
+
 // WriteBundleToPath is a helper to be able to write the bundle to a provided
 // directory.
 func (b *AppBundle) WriteBundleToPath(dir string, opts ...WriteOption) error {
@@ -49,10 +61,21 @@ func (b *AppBundle) WriteBundleToPath(dir string, opts ...WriteOption) error {
 func (ab *AppBundle) WriteBundle(out io.Writer, opts ...WriteOption) error {
 	var bundleFiles []string
 
+	source := ab.Source
+	for _, opt := range opts {
+		if o, ok := opt.(*withLibraryPathOption); ok {
+			lfs, err := runtime.NewLibraryFS(ab.Source, o.path)
+			if err != nil {
+				return fmt.Errorf("loading libraries: %w", err)
+			}
+			source = lfs
+		}
+	}
+
 	if slices.Contains(opts, WithoutRuntime()) {
 		// we can't use the runtime to determine the files to include in the
 		// bundle, so we'll just include everything in the source FS.
-		err := fs.WalkDir(ab.Source, ".", func(path string, d fs.DirEntry, err error) error {
+		err := fs.WalkDir(source, ".", func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return fmt.Errorf("walking directory: %w", err)
 			}
@@ -69,7 +92,7 @@ func (ab *AppBundle) WriteBundle(out io.Writer, opts ...WriteOption) error {
 		// since it could contain a lot of extraneous files. instead, run the
 		// applet and interrogate it for the files it needs to include in the
 		// bundle.
-		app, err := runtime.NewAppletFromFS(ab.Manifest.ID, ab.Source, runtime.WithPrintDisabled())
+		app, err := runtime.NewAppletFromFS(ab.Manifest.ID, source, runtime.WithPrintDisabled())
 		if err != nil {
 			return fmt.Errorf("loading applet for bundling: %w", err)
 		}
@@ -105,36 +128,66 @@ func (ab *AppBundle) WriteBundle(out io.Writer, opts ...WriteOption) error {
 		return fmt.Errorf("could not write manifest to archive: %w", err)
 	}
 
+	// local secrets hold plaintext, and must never be bundled, along with
+	// the keyset and key-encryption key that they refer to.
+	excluded := map[string]bool{}
+	for _, path := range bundleFiles {
+		if filepath.Base(path) != runtime.LocalSecretsFileName {
+			continue
+		}
+		excluded[filepath.Clean(path)] = true
+
+		b, err := fs.ReadFile(source, path)
+		if err != nil {
+			return fmt.Errorf("reading file %s: %w", path, err)
+		}
+		for _, key := range runtime.LocalSecretsKeyFiles(b) {
+			if !filepath.IsAbs(key) {
+				excluded[filepath.Join(filepath.Dir(path), key)] = true
+			}
+		}
+	}
+
 	// write sources.
 	for _, path := range bundleFiles {
-		stat, err := fs.Stat(ab.Source, path)
+		if excluded[filepath.Clean(path)] {
+			continue
+		}
+
+		stat, err := fs.Stat(source, path)
 		if err != nil {
 			return fmt.Errorf("could not stat %s: %w", path, err)
 		}
 
+		var contents []byte
+		if !stat.IsDir() {
+			contents, err = fs.ReadFile(source, path)
+			if err != nil {
+				return fmt.Errorf("reading file %s: %w", path, err)
+			}
+
+			// secrets and keys under other names are left for the
+			// developer to move out of the app, rather than bundled or
+			// silently dropped
+			if runtime.IsSecretFile(contents) {
+				return fmt.Errorf("refusing to bundle %s, which looks like a secrets file or key", path)
+			}
+		}
+
 		hdr, err := tar.FileInfoHeader(stat, "")
 		if err != nil {
 			return fmt.Errorf("creating header for %s: %w", path, err)
 		}
 		hdr.Name = filepath.ToSlash(path)
+		hdr.Size = int64(len(contents))
 
 		err = tw.WriteHeader(hdr)
 		if err != nil {
 			return fmt.Errorf("writing header for %s: %w", path, err)
 		}
 
-		if !stat.IsDir() {
-			file, err := ab.Source.Open(path)
-			if err != nil {
-				return fmt.Errorf("opening file %s: %w", path, err)
-			}
-
-			written, err := io.Copy(tw, file)
-			if err != nil {
-				return fmt.Errorf("writing file %s: %w", path, err)
-			} else if written != stat.Size() {
-				return fmt.Errorf("did not write entire file %s: %w", path, err)
-			}
+		if _, err := tw.Write(contents); err != nil {
+			return fmt.Errorf("writing file %s: %w", path, err)
 		}
 	}
 
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+)
+
+var (
+	cacheDir      string
+	cacheMaxBytes int64
+	cacheRedisURL string
+	cacheStale    time.Duration
+
+	// revalidations tracks the HTTP responses being revalidated in the
+	// background, which are cancelled with cancelRevalidations.
+	revalidations                        sync.WaitGroup
+	revalidationCtx, cancelRevalidations = context.WithCancel(context.Background())
+)
+
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&cacheDir, "cache-dir", "", "", "Persist the app and HTTP cache in this directory across runs")
+	cmd.Flags().Int64VarP(&cacheMaxBytes, "cache-max-bytes", "", runtime.DefaultFileCacheMaxBytes, "Maximum size of the on-disk cache (bytes)")
+	cmd.Flags().StringVarP(&cacheRedisURL, "cache-redis", "", "", "Share the app and HTTP cache through a Redis server (redis://[:password@]host[:port][/db])")
+	cmd.Flags().DurationVarP(&cacheStale, "cache-stale-grace", "", runtime.DefaultStaleGrace, "How long expired HTTP responses without a stale-if-error directive are served for when the server fails")
+}
+
+// cacheHTTPOptions returns the options for the HTTP cache selected by the
+// cache flags.
+func cacheHTTPOptions() []runtime.HTTPOption {
+	return []runtime.HTTPOption{
+		runtime.WithStaleGrace(cacheStale),
+		runtime.WithBackgroundRevalidation(revalidationCtx, &revalidations),
+	}
+}
+
+// finishRevalidations waits for the HTTP responses being revalidated in the
+// background, so that commands don't exit before they're refreshed in a
+// persistent cache. With the in-memory cache, they're cancelled instead,
+// since the cache goes away with the command.
+func finishRevalidations() {
+	if cacheDir == "" && cacheRedisURL == "" {
+		cancelRevalidations()
+	}
+	revalidations.Wait()
+}
+
+// newCache returns the cache selected by the cache flags. By default, an
+// in-memory cache is used.
+func newCache() (runtime.Cache, error) {
+	if cacheRedisURL != "" {
+		if cacheDir != "" {
+			return nil, fmt.Errorf("--cache-dir and --cache-redis cannot be used together")
+		}
+
+		cache, err := runtime.NewRedisCache(cacheRedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("configuring redis cache: %w", err)
+		}
+
+		return cache, nil
+	}
+
+	if cacheDir == "" {
+		return runtime.NewInMemoryCache(), nil
+	}
+
+	cache, err := runtime.NewFileCache(cacheDir, cacheMaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("opening cache in %s: %w", cacheDir, err)
+	}
+
+	return cache, nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/spf13/cobra"
 	"tidbyt.dev/pixlet/cmd/community"
 	"tidbyt.dev/pixlet/manifest"
+	"tidbyt.dev/pixlet/runtime"
 	"tidbyt.dev/pixlet/tools"
 )
 
@@ -20,6 +22,7 @@ var maxRenderTime = time.Duration(1 * time.Second)
 func init() {
 	CheckCmd.Flags().BoolVarP(&rflag, "recursive", "r", false, "find apps recursively")
 	CheckCmd.Flags().DurationVarP(&maxRenderTime, "max-render-time", "", maxRenderTime, "override the default max render time")
+	addLimitFlags(CheckCmd)
 }
 
 var CheckCmd = &cobra.Command{
@@ -108,6 +111,12 @@ func checkCmd(cmd *cobra.Command, args []string) error {
 		silenceOutput = true
 		output = f.Name()
 		err = render(cmd, []string{path})
+		var limitErr *runtime.LimitExceededError
+		if errors.As(err, &limitErr) {
+			foundIssue = true
+			failure(path, fmt.Errorf("app exceeded its execution budget: %w", err), fmt.Sprintf("try reducing the work your app does so that it stays within %d %s", limitErr.Max, limitErr.Limit))
+			continue
+		}
 		if err != nil {
 			foundIssue = true
 			failure(path, fmt.Errorf("app failed to render: %w", err), "try `pixlet render` and resolve any runtime issues")
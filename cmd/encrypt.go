@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
 	"go.starlark.net/starlark"
@@ -26,6 +27,12 @@ const PublicKeysetJSON = `{
   ]
 }`
 
+var encryptPublicKeyset string
+
+func init() {
+	EncryptCmd.Flags().StringVarP(&encryptPublicKeyset, "public-keyset", "", "", "Encrypt for this public keyset, from `pixlet keys export-public`, instead of the Tidbyt cloud")
+}
+
 var EncryptCmd = &cobra.Command{
 	Use:     "encrypt [app ID] [secret value]...",
 	Short:   "Encrypt a secret for use in the Tidbyt community repo",
@@ -39,6 +46,14 @@ func encrypt(cmd *cobra.Command, args []string) {
 		PublicKeysetJSON: []byte(PublicKeysetJSON),
 	}
 
+	if encryptPublicKeyset != "" {
+		b, err := os.ReadFile(encryptPublicKeyset)
+		if err != nil {
+			log.Fatalf("reading public keyset: %v", err)
+		}
+		sek.PublicKeysetJSON = b
+	}
+
 	appID := args[0]
 	encrypted := make([]string, len(args)-1)
 
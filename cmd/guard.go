@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+)
+
+var (
+	sandboxNetwork bool
+	allowHosts     []string
+	denyHosts      []string
+)
+
+func addNetworkGuardFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&sandboxNetwork, "sandbox-network", "", false, "Block HTTP requests to loopback, link-local, private and carrier-grade NAT addresses")
+	cmd.Flags().StringSliceVarP(&allowHosts, "allow-host", "", nil, "Hosts, IPs or CIDR ranges that apps may always reach (implies --sandbox-network)")
+	cmd.Flags().StringSliceVarP(&denyHosts, "deny-host", "", nil, "Hosts, IPs or CIDR ranges that apps may never reach (implies --sandbox-network)")
+}
+
+// networkGuard returns the guard configured by the network sandbox flags, or
+// nil if the sandbox is disabled.
+func networkGuard() *starlarkhttp.NetworkGuard {
+	if !sandboxNetwork && len(allowHosts) == 0 && len(denyHosts) == 0 {
+		return nil
+	}
+
+	return &starlarkhttp.NetworkGuard{
+		AllowHosts: allowHosts,
+		DenyHosts:  denyHosts,
+	}
+}
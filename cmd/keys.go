@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+)
+
+var (
+	keysetFile         string
+	kekFile            string
+	publicKeysetOutput string
+)
+
+func init() {
+	KeysCmd.PersistentFlags().StringVarP(&keysetFile, "keyset", "", runtime.DefaultKeysetFileName, "Path of the private keyset")
+	KeysCmd.PersistentFlags().StringVarP(&kekFile, "kek", "", "", "Path of the local key-encryption key (default $"+runtime.KeyEncryptionKeyEnv+", or kek.json in the user config directory)")
+	KeysExportPublicCmd.Flags().StringVarP(&publicKeysetOutput, "output", "o", "", "Path for the public keyset (default stdout)")
+
+	KeysCmd.AddCommand(KeysGenerateCmd)
+	KeysCmd.AddCommand(KeysExportPublicCmd)
+	KeysCmd.AddCommand(KeysRotateCmd)
+}
+
+var KeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage keysets for encrypting secrets",
+	Long: `Manage keysets for encrypting secrets.
+
+Apps published to the Tidbyt community repo use secrets encrypted for the
+Tidbyt cloud. To host apps yourself, generate your own private keyset, and
+encrypt secrets for it with:
+
+  pixlet keys generate
+  pixlet keys export-public -o public.json
+  pixlet encrypt --public-keyset public.json weather my-api-key
+
+Apps then decrypt those secrets when run with:
+
+  pixlet render --keyset ` + runtime.DefaultKeysetFileName + ` --app-id weather weather.star
+
+Private keysets are encrypted with a local key-encryption key, which is
+created by the first call to "pixlet keys generate". Keep it safe: without it,
+the keysets it protects can't be used.`,
+}
+
+var KeysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a private keyset",
+	Args:  cobra.NoArgs,
+	RunE:  keysGenerate,
+}
+
+var KeysExportPublicCmd = &cobra.Command{
+	Use:   "export-public",
+	Short: "Export the public keyset for encrypting secrets",
+	Args:  cobra.NoArgs,
+	RunE:  keysExportPublic,
+}
+
+var KeysRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Add a new primary key to a private keyset",
+	Long: `Add a new primary key to a private keyset.
+
+Secrets are encrypted for the new key once the public keyset is exported
+again. The old keys are kept, so secrets encrypted for them can still be
+decrypted.`,
+	Args: cobra.NoArgs,
+	RunE: keysRotate,
+}
+
+// kekPath returns the path of the local key-encryption key, which is path if
+// it's set.
+func kekPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	return runtime.DefaultKeyEncryptionKeyPath()
+}
+
+// loadSecretDecryptionKey reads the private keyset at keysetPath, protected
+// by the key-encryption key at kekFilePath or the default one.
+func loadSecretDecryptionKey(keysetPath, kekFilePath string) (*runtime.SecretDecryptionKey, error) {
+	path, err := kekPath(kekFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, err := runtime.LoadKeyEncryptionKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return runtime.LoadSecretDecryptionKey(keysetPath, kek)
+}
+
+func keysGenerate(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(keysetFile); err == nil {
+		return fmt.Errorf("%s already exists, use `pixlet keys rotate` to add a new key", keysetFile)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to stat %s: %w", keysetFile, err)
+	}
+
+	path, err := kekPath(kekFile)
+	if err != nil {
+		return err
+	}
+
+	kek, created, err := runtime.LoadOrGenerateKeyEncryptionKey(path)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Printf("created key-encryption key %s\n", path)
+	}
+
+	key, err := runtime.GenerateSecretDecryptionKey(kek)
+	if err != nil {
+		return err
+	}
+
+	if err := writeKeyset(key); err != nil {
+		return err
+	}
+
+	fmt.Printf("created keyset %s\n", keysetFile)
+	return nil
+}
+
+func keysExportPublic(cmd *cobra.Command, args []string) error {
+	key, err := loadSecretDecryptionKey(keysetFile, kekFile)
+	if err != nil {
+		return err
+	}
+
+	pub, err := key.EncryptionKey()
+	if err != nil {
+		return err
+	}
+
+	if publicKeysetOutput == "" {
+		fmt.Println(string(pub.PublicKeysetJSON))
+		return nil
+	}
+
+	if err := writeFileAtomic(publicKeysetOutput, pub.PublicKeysetJSON, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", publicKeysetOutput, err)
+	}
+
+	return nil
+}
+
+func keysRotate(cmd *cobra.Command, args []string) error {
+	key, err := loadSecretDecryptionKey(keysetFile, kekFile)
+	if err != nil {
+		return err
+	}
+
+	keyID, err := key.Rotate()
+	if err != nil {
+		return err
+	}
+
+	if err := writeKeyset(key); err != nil {
+		return err
+	}
+
+	fmt.Printf("added primary key %d to %s, export the public keyset again to use it\n", keyID, keysetFile)
+	return nil
+}
+
+func writeKeyset(key *runtime.SecretDecryptionKey) error {
+	if err := writeFileAtomic(keysetFile, key.EncryptedKeysetJSON, 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", keysetFile, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes b to path through a temporary file in the same
+// directory, which is synced and renamed over path, so that an interrupted
+// write never leaves a truncated keyset in place of the only copy.
+func writeFileAtomic(path string, b []byte, perm fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
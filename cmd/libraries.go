@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+)
+
+var libraryPathFlag []string
+
+func addLibraryFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&libraryPathFlag, "lib-path", "", nil, "Directories to search for libraries loaded with @<library>//<path>, before those in $"+runtime.LibraryPathEnv)
+}
+
+// libraryPath returns the directories to search for shared libraries: those
+// given with --lib-path, followed by those in the environment.
+func libraryPath() []string {
+	return runtime.LibraryPath(libraryPathFlag)
+}
+
+// libraryOptions returns the applet options for the library path.
+func libraryOptions() []runtime.AppletOption {
+	return []runtime.AppletOption{runtime.WithLibraryPath(libraryPath())}
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+)
+
+var limits runtime.Limits
+
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint64VarP(&limits.MaxExecutionSteps, "max-steps", "", 0, "Maximum number of Starlark execution steps per run (0 for no limit)")
+	cmd.Flags().IntVarP(&limits.MaxHTTPRequests, "max-http-requests", "", 0, "Maximum number of HTTP requests per run (0 for no limit)")
+	cmd.Flags().Int64VarP(&limits.MaxHTTPResponseBytes, "max-http-response-bytes", "", 0, "Maximum number of HTTP response bytes read per run (0 for no limit)")
+	cmd.Flags().IntVarP(&limits.MaxFrames, "max-frames", "", 0, "Maximum number of rendered frames (0 for no limit)")
+}
+
+// limitOptions returns the applet options for the execution budget flags.
+func limitOptions() []runtime.AppletOption {
+	if limits == (runtime.Limits{}) {
+		return nil
+	}
+
+	return []runtime.AppletOption{runtime.WithLimits(limits)}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+)
+
+func init() {
+	addLibraryFlags(LockCmd)
+}
+
+var LockCmd = &cobra.Command{
+	Use:     "lock <app-dir>",
+	Example: `  pixlet lock --lib-path ../libraries apps/weather`,
+	Short:   "Pin the shared libraries used by a Pixlet app",
+	Long: `Pin the shared libraries used by a Pixlet app.
+
+Apps can load files from shared libraries on the library path, which is set
+with --lib-path and the ` + runtime.LibraryPathEnv + ` environment variable:
+
+  load("@teamlib//weather.star", "fetch")
+
+This command loads the app and writes the hashes of every library file it
+loads to ` + runtime.LibraryLockFileName + ` in the app directory. Once the lockfile exists,
+the app fails to load if a library file changes or a new one is loaded,
+until the lockfile is updated by running this command again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: lock,
+}
+
+func lock(cmd *cobra.Command, args []string) error {
+	dir := args[0]
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("lockfiles are only supported for apps in a directory: %s", dir)
+	}
+
+	// the existing lockfile is ignored, since it's being replaced
+	fsys := &runtime.LibraryFS{
+		App:  os.DirFS(dir),
+		Path: libraryPath(),
+	}
+
+	applet, err := runtime.NewAppletFromFS(filepath.Base(dir), fsys, runtime.WithPrintDisabled())
+	if err != nil {
+		return fmt.Errorf("failed to load applet: %w", err)
+	}
+
+	lock, err := applet.LockLibraries(fsys)
+	if err != nil {
+		return err
+	}
+
+	b, err := lock.MarshalIndent()
+	if err != nil {
+		return fmt.Errorf("serializing lockfile: %w", err)
+	}
+
+	path := filepath.Join(dir, runtime.LibraryLockFileName)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	fmt.Printf("locked %d library files in %s\n", len(lock.Libraries), path)
+	return nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+)
+
+var modulesJSON bool
+
+func init() {
+	ModulesCmd.Flags().BoolVarP(&modulesJSON, "json", "", false, "Print the modules as JSON")
+}
+
+var ModulesCmd = &cobra.Command{
+	Use:   "modules",
+	Short: "List the modules available to Pixlet apps",
+	Args:  cobra.NoArgs,
+	RunE:  listModules,
+}
+
+type moduleJSON struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	NeedsNetwork  bool   `json:"needs_network"`
+	Deterministic bool   `json:"deterministic"`
+}
+
+func listModules(cmd *cobra.Command, args []string) error {
+	modules := runtime.DefaultModules.Modules()
+
+	if modulesJSON {
+		out := make([]moduleJSON, 0, len(modules))
+		for _, m := range modules {
+			out = append(out, moduleJSON{
+				Name:          m.Name,
+				Description:   m.Description,
+				NeedsNetwork:  m.NeedsNetwork,
+				Deterministic: m.Deterministic,
+			})
+		}
+
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return fmt.Errorf("serializing modules to JSON: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "MODULE\tNETWORK\tDETERMINISTIC\tDESCRIPTION\n")
+	for _, m := range modules {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, yesNo(m.NeedsNetwork), yesNo(m.Deterministic), m.Description)
+	}
+
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -6,12 +6,15 @@ import (
 
 	"github.com/spf13/cobra"
 	"tidbyt.dev/pixlet/bundle"
+	"tidbyt.dev/pixlet/runtime"
 )
 
 var bundleOutput string
+var bundleLibraryPath []string
 
 func init() {
 	BundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "./", "output directory for the bundle")
+	BundleCmd.Flags().StringSliceVarP(&bundleLibraryPath, "lib-path", "", nil, "directories to search for libraries loaded with @<library>//<path>, before those in $"+runtime.LibraryPathEnv)
 }
 
 var BundleCmd = &cobra.Command{
@@ -20,7 +23,9 @@ var BundleCmd = &cobra.Command{
 	Example: `  pixlet bundle ./my-app`,
 	Long: `This command will create a new app bundle from an app directory. The directory
 should contain an app manifest and source file. The output of this command will
-be a gzip compressed tar file that can be uploaded to Tidbyt for deployment.`,
+be a gzip compressed tar file that can be uploaded to Tidbyt for deployment.
+
+Shared libraries loaded by the app are included in the bundle.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		bundleInput := args[0]
@@ -47,6 +52,6 @@ be a gzip compressed tar file that can be uploaded to Tidbyt for deployment.`,
 			return fmt.Errorf("could not init bundle: %w", err)
 		}
 
-		return ab.WriteBundleToPath(bundleOutput)
+		return ab.WriteBundleToPath(bundleOutput, bundle.WithLibraryPath(runtime.LibraryPath(bundleLibraryPath)))
 	},
 }
@@ -13,12 +13,14 @@ import (
 	"github.com/spf13/cobra"
 	"tidbyt.dev/pixlet/bundle"
 	"tidbyt.dev/pixlet/cmd/config"
+	"tidbyt.dev/pixlet/runtime"
 )
 
 var uploadVersion string
 var uploadDir string
 var uploadURL string
 var uploadSkipDeploy bool
+var uploadLibraryPath []string
 
 var defaultVersion = fmt.Sprintf("%d", time.Now().Unix())
 
@@ -33,6 +35,7 @@ func init() {
 	UploadCmd.Flags().StringVarP(&uploadVersion, "version", "v", defaultVersion, "version of the app")
 	UploadCmd.Flags().StringVarP(&uploadURL, "url", "u", "https://api.tidbyt.com", "base URL of Tidbyt API")
 	UploadCmd.Flags().BoolVarP(&uploadSkipDeploy, "skip-deploy", "s", false, "skip deploying the bundle after uploading")
+	UploadCmd.Flags().StringSliceVarP(&uploadLibraryPath, "lib-path", "", nil, "directories to search for libraries loaded with @<library>//<path>, before those in $"+runtime.LibraryPathEnv)
 }
 
 var UploadCmd = &cobra.Command{
@@ -67,7 +70,7 @@ flags.`,
 		if err != nil {
 			return fmt.Errorf("could not init bundle: %w", err)
 		}
-		err = ab.WriteBundle(buf)
+		err = ab.WriteBundle(buf, bundle.WithLibraryPath(runtime.LibraryPath(uploadLibraryPath)))
 		if err != nil {
 			return err
 		}
@@ -26,6 +26,8 @@ func init() {
 	ProfileCmd.Flags().StringVarP(
 		&pprof_cmd, "pprof", "", "top 10", "Command to call pprof with",
 	)
+	addCacheFlags(ProfileCmd)
+	addLibraryFlags(ProfileCmd)
 }
 
 var ProfileCmd = &cobra.Command{
@@ -111,11 +113,15 @@ func ProfileApp(path string, config map[string]string) (*pprof_profile.Profile,
 		fsys = tools.NewSingleFileFS(path)
 	}
 
-	cache := runtime.NewInMemoryCache()
-	runtime.InitHTTP(cache)
+	cache, err := newCache()
+	if err != nil {
+		return nil, err
+	}
+	runtime.InitHTTP(cache, cacheHTTPOptions()...)
 	runtime.InitCache(cache)
+	defer finishRevalidations()
 
-	applet, err := runtime.NewAppletFromFS(path, fsys, runtime.WithPrintDisabled())
+	applet, err := runtime.NewAppletFromFS(path, fsys, append(libraryOptions(), runtime.WithPrintDisabled())...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load applet: %w", err)
 	}
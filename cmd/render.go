@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"image"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +18,7 @@ import (
 	"tidbyt.dev/pixlet/globals"
 	"tidbyt.dev/pixlet/runtime"
 	"tidbyt.dev/pixlet/tools"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 var (
@@ -27,6 +30,13 @@ var (
 	width         int
 	height        int
 	timeout       int
+	recordDir     string
+	replayDir     string
+	reportFormat  string
+	errorsFormat  string
+	renderAt      string
+	validateConf  bool
+	traceFile     string
 )
 
 func init() {
@@ -68,6 +78,18 @@ func init() {
 		30000,
 		"Timeout for execution (ms)",
 	)
+	RenderCmd.Flags().StringVarP(&recordDir, "record", "", "", "Record HTTP requests and responses to this directory")
+	RenderCmd.Flags().StringVarP(&replayDir, "replay", "", "", "Serve HTTP responses recorded with --record from this directory")
+	RenderCmd.Flags().StringVarP(&reportFormat, "report", "", "", "Print a report of the run's HTTP requests, cache operations, prints and timings (json)")
+	RenderCmd.Flags().StringVarP(&errorsFormat, "errors", "", "text", "Format of errors raised by the app: text, or json with the file, line and stack")
+	RenderCmd.Flags().BoolVarP(&validateConf, "validate-config", "", false, "Validate config against the app's schema, and fill in defaults, before running it")
+	RenderCmd.Flags().StringVarP(&traceFile, "trace", "", "", "Write a trace of the run, in Chrome trace event format, to this file (open it in https://ui.perfetto.dev)")
+	RenderCmd.Flags().StringVarP(&renderAt, "at", "", "", "Render the app as if it started at this time (RFC 3339, e.g. 2026-12-31T23:59:50-05:00), with the clock running from there")
+	addCacheFlags(RenderCmd)
+	addNetworkGuardFlags(RenderCmd)
+	addLimitFlags(RenderCmd)
+	addLibraryFlags(RenderCmd)
+	addSecretsFlags(RenderCmd)
 }
 
 var RenderCmd = &cobra.Command{
@@ -83,7 +105,7 @@ containing multiple Starlark files and resources.
 	`,
 }
 
-func render(cmd *cobra.Command, args []string) error {
+func render(cmd *cobra.Command, args []string) (err error) {
 	path := args[0]
 
 	// check if path exists, and whether it is a directory or a file
@@ -127,12 +149,60 @@ func render(cmd *cobra.Command, args []string) error {
 		config[split[0]] = strings.Join(split[1:], "=")
 	}
 
+	if reportFormat != "" && reportFormat != "json" {
+		return fmt.Errorf("unsupported report format: %s", reportFormat)
+	}
+
+	if errorsFormat != "text" && errorsFormat != "json" {
+		return fmt.Errorf("unsupported errors format: %s", errorsFormat)
+	}
+
 	// Remove the print function from the starlark thread if the silent flag is
-	// passed.
+	// passed. Prints are part of the report, so they are also removed when a
+	// report is requested, to keep it readable.
 	var opts []runtime.AppletOption
-	if silenceOutput {
+	if silenceOutput || reportFormat != "" {
 		opts = append(opts, runtime.WithPrintDisabled())
 	}
+	opts = append(opts, limitOptions()...)
+	opts = append(opts, libraryOptions()...)
+
+	secretsOpts, err := secretsOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, secretsOpts...)
+
+	if validateConf {
+		opts = append(opts, runtime.WithConfigValidation())
+	}
+
+	if renderAt != "" {
+		at, err := time.Parse(time.RFC3339, renderAt)
+		if err != nil {
+			return fmt.Errorf("parsing --at: %w", err)
+		}
+
+		// the clock starts at --at and runs from there, as it would in a
+		// normal run, so that the app can still measure elapsed time
+		start := time.Now()
+		opts = append(opts, runtime.WithClock(func() time.Time {
+			return at.Add(time.Since(start))
+		}))
+	}
+
+	// the trace is written even if the app fails, since it shows what
+	// the app was doing when it did
+	var tracer *tracing.Tracer
+	if traceFile != "" {
+		tracer = tracing.NewTracer()
+		opts = append(opts, runtime.WithTracer(tracer))
+		defer func() {
+			if traceErr := writeTrace(tracer); traceErr != nil && err == nil {
+				err = traceErr
+			}
+		}()
+	}
 
 	ctx := context.Background()
 	if timeout > 0 {
@@ -143,20 +213,44 @@ func render(cmd *cobra.Command, args []string) error {
 		)
 	}
 
-	cache := runtime.NewInMemoryCache()
-	runtime.InitHTTP(cache)
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	httpOpts := cacheHTTPOptions()
+	var transport http.RoundTripper = http.DefaultTransport
+	if guard := networkGuard(); guard != nil {
+		httpOpts = append(httpOpts, runtime.WithNetworkGuard(guard))
+		transport = guard.Transport()
+	}
+
+	cassetteOpts, err := cassetteHTTPOptions(transport)
+	if err != nil {
+		return err
+	}
+	httpOpts = append(httpOpts, cassetteOpts...)
+
+	runtime.InitHTTP(cache, httpOpts...)
 	runtime.InitCache(cache)
+	defer finishRevalidations()
 
 	applet, err := runtime.NewAppletFromFS(filepath.Base(path), fs, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to load applet: %w", err)
+		return writeAppError(cmd, fmt.Errorf("failed to load applet: %w", err))
 	}
 
-	roots, err := applet.RunWithConfig(ctx, config)
+	result, err := applet.RunWithResult(ctx, config)
+	if reportFormat != "" {
+		if reportErr := writeRunReport(result); reportErr != nil {
+			return reportErr
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("error running script: %w", err)
+		return writeAppError(cmd, fmt.Errorf("error running script: %w", err))
 	}
-	screens := encode.ScreensFromRoots(roots)
+	screens := encode.ScreensFromRoots(result.Roots)
+	screens.Tracer = tracer
 
 	filter := func(input image.Image) (image.Image, error) {
 		if magnify <= 1 {
@@ -217,3 +311,97 @@ func render(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// writeRunReport prints the report requested with --report. It goes to
+// stdout, unless the rendered image is written there.
+func writeRunReport(result *runtime.RunResult) error {
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("serializing report: %w", err)
+	}
+
+	w := os.Stdout
+	if output == "-" {
+		w = os.Stderr
+	}
+
+	if _, err := fmt.Fprintln(w, string(b)); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+
+	return nil
+}
+
+// writeTrace writes the spans recorded by tracer to the file set with
+// --trace.
+func writeTrace(tracer *tracing.Tracer) error {
+	f, err := os.Create(traceFile)
+	if err != nil {
+		return fmt.Errorf("writing trace: %w", err)
+	}
+
+	if err := tracer.WriteJSON(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing trace: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing trace: %w", err)
+	}
+
+	return nil
+}
+
+// writeAppError reports err, raised by the app, in the format set by --errors,
+// and returns it. JSON errors are written to stderr in place of the usual
+// error message.
+func writeAppError(cmd *cobra.Command, err error) error {
+	if errorsFormat != "json" {
+		return err
+	}
+
+	b, jsonErr := json.MarshalIndent(runtime.AsAppError(err), "", "  ")
+	if jsonErr != nil {
+		return fmt.Errorf("serializing error: %w", jsonErr)
+	}
+
+	fmt.Fprintln(os.Stderr, string(b))
+	cmd.SilenceErrors = true
+	return err
+}
+
+// cassetteHTTPOptions sets up recording or replaying of HTTP interactions
+// according to the --record and --replay flags. Recorded requests are sent
+// through transport.
+func cassetteHTTPOptions(transport http.RoundTripper) ([]runtime.HTTPOption, error) {
+	switch {
+	case recordDir != "" && replayDir != "":
+		return nil, fmt.Errorf("--record and --replay cannot be used together")
+
+	case recordDir != "":
+		if cacheDir != "" || cacheRedisURL != "" {
+			// responses served from a warm cache would never be recorded
+			return nil, fmt.Errorf("--record cannot be used with a persistent cache")
+		}
+		if secretsFile != "" || secretsKeyset != "" {
+			// cassettes would hold the plaintext of secrets that the app
+			// sends, e.g. API keys in URLs and headers
+			return nil, fmt.Errorf("--record cannot be used with --secrets or --keyset")
+		}
+
+		recorder, err := runtime.NewCassetteRecorder(recordDir, transport)
+		if err != nil {
+			return nil, err
+		}
+		return []runtime.HTTPOption{runtime.WithHTTPTransport(recorder)}, nil
+
+	case replayDir != "":
+		replayer, err := runtime.NewCassetteReplayer(replayDir)
+		if err != nil {
+			return nil, err
+		}
+		return []runtime.HTTPOption{runtime.WithHTTPTransport(replayer)}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.starlark.net/starlark"
+
+	pixlet_render "tidbyt.dev/pixlet/render"
+	"tidbyt.dev/pixlet/runtime"
+	"tidbyt.dev/pixlet/runtime/modules/render_runtime"
+	"tidbyt.dev/pixlet/tools"
+)
+
+func init() {
+	addCacheFlags(ReplCmd)
+	addNetworkGuardFlags(ReplCmd)
+	addLibraryFlags(ReplCmd)
+	addSecretsFlags(ReplCmd)
+}
+
+var ReplCmd = &cobra.Command{
+	Use:   "repl [path]",
+	Short: "Run Starlark interactively, with Pixlet's modules",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  repl,
+	Long: `Run Starlark interactively, with Pixlet's modules.
+
+Modules are loaded as in apps, e.g. load("render.star", "render"), and
+values are kept between statements. Expressions that evaluate to a widget
+or a Root are previewed in the terminal, which must support true colour.
+
+If a path to an app is given, its globals are available in the REPL, and
+the files of the app can be loaded. Press Ctrl-D to exit.`,
+}
+
+func repl(cmd *cobra.Command, args []string) error {
+	var (
+		id   = "repl"
+		fsys fs.FS
+	)
+
+	if len(args) > 0 {
+		path := args[0]
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+
+		if info.IsDir() {
+			fsys = os.DirFS(path)
+		} else {
+			if !strings.HasSuffix(path, ".star") {
+				return fmt.Errorf("script file must have suffix .star: %s", path)
+			}
+
+			fsys = tools.NewSingleFileFS(path)
+		}
+		id = filepath.Base(path)
+	}
+
+	opts := libraryOptions()
+
+	secretsOpts, err := secretsOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, secretsOpts...)
+
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	httpOpts := cacheHTTPOptions()
+	if guard := networkGuard(); guard != nil {
+		httpOpts = append(httpOpts, runtime.WithNetworkGuard(guard))
+	}
+
+	runtime.InitHTTP(cache, httpOpts...)
+	runtime.InitCache(cache)
+	defer finishRevalidations()
+
+	r, err := runtime.NewREPL(id, fsys, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load applet: %w", err)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	prompt := ">>> "
+	readLine := func() ([]byte, error) {
+		fmt.Print(prompt)
+		prompt = "... "
+
+		line, err := in.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return nil, err
+		}
+		return []byte(strings.TrimSuffix(line, "\n") + "\n"), nil
+	}
+
+	for {
+		prompt = ">>> "
+		f, err := r.Parse(readLine)
+		if errors.Is(err, io.EOF) {
+			fmt.Println()
+			return nil
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		// Ctrl-C cancels the statement being run, rather than exiting
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		val, err := r.Exec(ctx, f)
+		stop()
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		printREPLValue(val)
+	}
+}
+
+// printREPLValue prints the value of an expression, with a preview of
+// widgets and roots.
+func printREPLValue(val starlark.Value) {
+	if val == starlark.None {
+		return
+	}
+
+	var root pixlet_render.Root
+	switch v := val.(type) {
+	case render_runtime.Rootable:
+		root = v.AsRenderRoot()
+	case render_runtime.Widget:
+		root = pixlet_render.Root{Child: v.AsRenderWidget()}
+	default:
+		fmt.Println(val)
+		return
+	}
+
+	frames := root.Paint(true, pixlet_render.WithMaxFrameCount(1))
+	if len(frames) > 0 {
+		fmt.Print(ansiImage(frames[0]))
+	}
+
+	if n := root.Child.FrameCount(); n > 1 {
+		fmt.Printf("%s (first of %d frames)\n", val.Type(), n)
+	} else {
+		fmt.Println(val.Type())
+	}
+}
+
+// ansiImage draws img with ANSI true colour escape codes. Each character is
+// a half block, showing two rows of pixels.
+func ansiImage(img image.Image) string {
+	b := img.Bounds()
+	sb := &strings.Builder{}
+
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			tr, tg, tb, _ := img.At(x, y).RGBA()
+			fmt.Fprintf(sb, "\x1b[38;2;%d;%d;%dm", tr>>8, tg>>8, tb>>8)
+
+			if y+1 < b.Max.Y {
+				br, bg, bb, _ := img.At(x, y+1).RGBA()
+				fmt.Fprintf(sb, "\x1b[48;2;%d;%d;%dm", br>>8, bg>>8, bb>>8)
+			} else {
+				sb.WriteString("\x1b[49m")
+			}
+
+			sb.WriteString("▀")
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+)
+
+var (
+	secretsFile   string
+	secretsKeyset string
+	secretsKEK    string
+	secretsAppID  string
+)
+
+func addSecretsFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&secretsFile, "secrets", "", "", "YAML file of local secrets for secret.decrypt(), e.g. "+runtime.LocalSecretsFileName)
+	cmd.Flags().StringVarP(&secretsKeyset, "keyset", "", "", "Private keyset from `pixlet keys generate` for secret.decrypt()")
+	cmd.Flags().StringVarP(&secretsKEK, "kek", "", "", "Path of the local key-encryption key for --keyset")
+	cmd.Flags().StringVarP(&secretsAppID, "app-id", "", "", "App ID that secrets were encrypted for")
+}
+
+// secretsOptions returns the applet options for the secrets flags.
+func secretsOptions() ([]runtime.AppletOption, error) {
+	if secretsFile == "" && secretsKeyset == "" {
+		return nil, nil
+	}
+
+	secrets := &runtime.LocalSecrets{}
+	if secretsFile != "" {
+		var err error
+		if secrets, err = runtime.LoadLocalSecrets(secretsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if secretsKeyset != "" {
+		if secrets.Keyset != "" {
+			return nil, fmt.Errorf("--keyset cannot be used with a secrets file that has a keyset")
+		}
+
+		key, err := loadSecretDecryptionKey(secretsKeyset, secretsKEK)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := secrets.SetDecryptionKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if secretsAppID != "" {
+		secrets.AppID = secretsAppID
+	}
+
+	return []runtime.AppletOption{runtime.WithLocalSecrets(secrets)}, nil
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
+	"tidbyt.dev/pixlet/runtime"
 	"tidbyt.dev/pixlet/server"
 )
 
@@ -18,6 +19,12 @@ func init() {
 	ServeCmd.Flags().BoolVarP(&watch, "watch", "w", true, "Reload scripts on change. Does not recurse sub-directories.")
 	ServeCmd.Flags().IntVarP(&maxDuration, "max_duration", "d", 15000, "Maximum allowed animation duration (ms)")
 	ServeCmd.Flags().IntVarP(&timeout, "timeout", "", 30000, "Timeout for execution (ms)")
+	ServeCmd.Flags().BoolVarP(&validateConf, "validate-config", "", false, "Validate config against the app's schema, and fill in defaults, before running it")
+	addCacheFlags(ServeCmd)
+	addNetworkGuardFlags(ServeCmd)
+	addLibraryFlags(ServeCmd)
+	addSecretsFlags(ServeCmd)
+	addLimitFlags(ServeCmd)
 }
 
 var ServeCmd = &cobra.Command{
@@ -33,7 +40,29 @@ containing multiple Starlark files and resources.`,
 }
 
 func serve(cmd *cobra.Command, args []string) error {
-	s, err := server.NewServer(host, port, watch, args[0], maxDuration, timeout)
+	cache, err := newCache()
+	if err != nil {
+		return err
+	}
+
+	httpOpts := cacheHTTPOptions()
+	if guard := networkGuard(); guard != nil {
+		httpOpts = append(httpOpts, runtime.WithNetworkGuard(guard))
+	}
+
+	appletOpts := append(libraryOptions(), limitOptions()...)
+
+	secretsOpts, err := secretsOptions()
+	if err != nil {
+		return err
+	}
+	appletOpts = append(appletOpts, secretsOpts...)
+
+	if validateConf {
+		appletOpts = append(appletOpts, runtime.WithConfigValidation())
+	}
+
+	s, err := server.NewServer(host, port, watch, args[0], maxDuration, timeout, cache, httpOpts, appletOpts)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"tidbyt.dev/pixlet/runtime"
+	"tidbyt.dev/pixlet/tools"
+	"tidbyt.dev/pixlet/tools/golden"
+)
+
+var (
+	testRun          string
+	testJUnit        string
+	testGolden       bool
+	testUpdateGolden bool
+	testGoldenFormat string
+)
+
+func init() {
+	TestCmd.Flags().StringVarP(&testRun, "run", "", "", "Only run tests whose name (file/function) matches this regular expression")
+	TestCmd.Flags().StringVarP(&testJUnit, "junit", "", "", "Write test results to this file in JUnit XML format")
+	addLibraryFlags(TestCmd)
+	TestCmd.Flags().BoolVarP(&testGolden, "golden", "", false, "Also compare renders of each app against its golden snapshots")
+	TestCmd.Flags().BoolVarP(&testUpdateGolden, "update", "", false, "Rewrite golden snapshots with the current renders")
+	TestCmd.Flags().StringVarP(&testGoldenFormat, "golden-format", "", "png", "Format of new golden snapshots: png or ascii")
+}
+
+var TestCmd = &cobra.Command{
+	Use: "test <app-or-dir>...",
+	Example: `  pixlet test examples/clock
+  pixlet test --run test_format --junit results.xml apps/`,
+	Short: "Run the Starlark tests of Pixlet apps",
+	Long: `Run the Starlark tests of Pixlet apps.
+
+Every function whose name starts with test_ in an app's Starlark files is
+run as a test. Tests use the assert module to check their results:
+
+  load("assert.star", "assert")
+
+  def test_format():
+      assert.eq(format_temp(21.5), "22°")
+
+The http_mock module answers the HTTP requests that apps make during tests
+with canned responses.
+
+Each path can be an app, either a single file with the .star extension or a
+directory containing multiple Starlark files and resources, or a directory of
+apps, which is searched recursively.
+
+With --golden, each app is also rendered with every config fixture in its
+testdata/golden directory (testdata/golden/<name> for single file apps), and
+the frames are compared against the snapshots stored there. A fixture is a
+JSON file holding the config, and optionally the time to render at:
+
+  {"config": {"units": "metric"}, "at": "2024-01-02T15:04:05Z"}
+
+Apps without fixtures are rendered once with empty config. Changes to any
+pixel, the number of frames or the delay between them fail the test. Run
+with --update to rewrite the snapshots after an intended change.
+
+The command fails if any test fails.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: test,
+}
+
+func test(cmd *cobra.Command, args []string) error {
+	var match func(string) bool
+	if testRun != "" {
+		re, err := regexp.Compile(testRun)
+		if err != nil {
+			return fmt.Errorf("parsing --run: %w", err)
+		}
+		match = re.MatchString
+	}
+
+	if testUpdateGolden && !testGolden {
+		return fmt.Errorf("--update requires --golden")
+	}
+
+	switch golden.Format(testGoldenFormat) {
+	case golden.FormatPNG, golden.FormatASCII:
+	default:
+		return fmt.Errorf("invalid --golden-format: %s", testGoldenFormat)
+	}
+
+	var apps []string
+	for _, path := range args {
+		found, err := findTestApps(path)
+		if err != nil {
+			return err
+		}
+		apps = append(apps, found...)
+	}
+
+	if len(apps) == 0 {
+		return fmt.Errorf("no apps found in %s", strings.Join(args, ", "))
+	}
+
+	cache := runtime.NewInMemoryCache()
+	runtime.InitHTTP(cache)
+	runtime.InitCache(cache)
+
+	suites := &junitTestSuites{}
+	failed := 0
+
+	for _, path := range apps {
+		suite := runAppTests(path, match)
+		suites.Suites = append(suites.Suites, suite)
+
+		if suite.Failures > 0 {
+			failed++
+			fmt.Printf("FAIL\t%s\t%d of %d tests failed\n", path, suite.Failures, suite.Tests)
+		} else {
+			fmt.Printf("ok  \t%s\t%d tests\n", path, suite.Tests)
+		}
+	}
+
+	if testJUnit != "" {
+		b, err := xml.MarshalIndent(suites, "", "  ")
+		if err != nil {
+			return fmt.Errorf("serializing JUnit report: %w", err)
+		}
+
+		b = append([]byte(xml.Header), b...)
+		if err := os.WriteFile(testJUnit, b, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", testJUnit, err)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("tests failed in %d of %d apps", failed, len(apps))
+	}
+
+	return nil
+}
+
+// runAppTests loads the app at path and runs its tests, printing the outcome
+// of each one.
+func runAppTests(path string, match func(string) bool) junitTestSuite {
+	suite := junitTestSuite{Name: path}
+
+	var fsys fs.FS
+	var goldenDir string
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		fsys = os.DirFS(path)
+		goldenDir = filepath.Join(path, "testdata", "golden")
+	} else {
+		fsys = tools.NewSingleFileFS(path)
+		goldenDir = filepath.Join(
+			filepath.Dir(path), "testdata", "golden",
+			strings.TrimSuffix(filepath.Base(path), ".star"),
+		)
+	}
+
+	// golden fixtures can pin the time, so the applet's clock is set before
+	// rendering each one
+	var now time.Time
+	clock := func() time.Time {
+		if now.IsZero() {
+			return time.Now()
+		}
+		return now
+	}
+
+	start := time.Now()
+	opts := append(libraryOptions(), runtime.WithClock(clock), runtime.WithModule(runtime.HTTPMockModule))
+	applet, err := runtime.NewAppletFromFS(filepath.Base(path), fsys, opts...)
+	if err != nil {
+		// report the failure to load as a failed test, so that it shows up in
+		// CI like any other
+		result := &runtime.TestResult{
+			Name:     "load",
+			Failures: []string{err.Error()},
+			Duration: time.Since(start),
+		}
+		printTestResult(path, result)
+		suite.add(result)
+		return suite
+	}
+
+	for _, result := range applet.RunTestFunctions(context.Background(), match) {
+		printTestResult(path, result)
+		suite.add(result)
+	}
+
+	if !testGolden {
+		return suite
+	}
+
+	store := &golden.Store{
+		Dir:    goldenDir,
+		Format: golden.Format(testGoldenFormat),
+	}
+
+	fixtures, err := store.Fixtures()
+	if err != nil {
+		result := &runtime.TestResult{
+			Name:     "golden",
+			Failures: []string{err.Error()},
+		}
+		printTestResult(path, result)
+		suite.add(result)
+		return suite
+	}
+
+	for _, fixture := range fixtures {
+		name := "golden/" + fixture.Name
+		if match != nil && !match(name) {
+			continue
+		}
+
+		now = fixture.At
+		result := runGoldenTest(applet, store, fixture)
+		result.Name = name
+
+		printTestResult(path, result)
+		suite.add(result)
+	}
+
+	return suite
+}
+
+// runGoldenTest renders the applet with a fixture and compares the result
+// against the fixture's snapshot, or replaces the snapshot with --update.
+func runGoldenTest(applet *runtime.Applet, store *golden.Store, fixture golden.Fixture) *runtime.TestResult {
+	result := &runtime.TestResult{}
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	roots, err := applet.RunWithConfig(context.Background(), fixture.Config)
+	if err != nil {
+		result.Failures = append(result.Failures, fmt.Sprintf("error running app: %v", err))
+		return result
+	}
+	actual := golden.SnapshotFromRoots(roots)
+
+	if testUpdateGolden {
+		if err := store.Save(fixture.Name, actual); err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("error saving snapshot: %v", err))
+		}
+		return result
+	}
+
+	expected, err := store.Load(fixture.Name)
+	if errors.Is(err, golden.ErrNoSnapshot) {
+		result.Failures = append(result.Failures, "no snapshot, run with --update to create one")
+		return result
+	} else if err != nil {
+		result.Failures = append(result.Failures, err.Error())
+		return result
+	}
+
+	for _, diff := range golden.Compare(expected, actual) {
+		result.Failures = append(result.Failures, diff.String())
+	}
+
+	return result
+}
+
+func printTestResult(app string, result *runtime.TestResult) {
+	status := "PASS"
+	if !result.Passed() {
+		status = "FAIL"
+	}
+
+	fmt.Printf("--- %s: %s/%s (%.2fs)\n", status, app, result.Name, result.Duration.Seconds())
+
+	for _, failure := range result.Failures {
+		for _, line := range strings.Split(failure, "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
+// findTestApps returns the apps at path. A .star file or a directory that
+// contains .star files is an app. Other directories are searched for apps.
+func findTestApps(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	if !info.IsDir() {
+		if !strings.HasSuffix(path, ".star") {
+			return nil, fmt.Errorf("script file must have suffix .star: %s", path)
+		}
+		return []string{path}, nil
+	}
+
+	var apps []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		stars, err := filepath.Glob(filepath.Join(p, "*.star"))
+		if err != nil {
+			return err
+		}
+
+		if len(stars) > 0 {
+			apps = append(apps, p)
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("searching %s for apps: %w", path, err)
+	}
+
+	return apps, nil
+}
+
+// junitTestSuites is the root of a JUnit XML report. Every app is a test
+// suite.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+
+	duration time.Duration
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (s *junitTestSuite) add(result *runtime.TestResult) {
+	tc := junitTestCase{
+		Name:      result.Name,
+		Classname: s.Name,
+		Time:      fmt.Sprintf("%.3f", result.Duration.Seconds()),
+	}
+
+	if !result.Passed() {
+		message, _, _ := strings.Cut(result.Failures[len(result.Failures)-1], "\n")
+		tc.Failure = &junitFailure{
+			Message: message,
+			Text:    strings.Join(result.Failures, "\n\n"),
+		}
+		s.Failures++
+	}
+
+	s.Tests++
+	s.duration += result.Duration
+	s.Time = fmt.Sprintf("%.3f", s.duration.Seconds())
+	s.Cases = append(s.Cases, tc)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 
 	"tidbyt.dev/pixlet/render"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 const (
@@ -23,6 +24,9 @@ type Screens struct {
 	delay             int32
 	MaxAge            int32
 	ShowFullAnimation bool
+
+	// Tracer, if set, records spans for painting and encoding the screens.
+	Tracer *tracing.Tracer
 }
 
 type ImageFilter func(image.Image) (image.Image, error)
@@ -86,7 +90,10 @@ func (s *Screens) Hash() ([]byte, error) {
 
 func (s *Screens) render(filters ...ImageFilter) ([]image.Image, error) {
 	if s.images == nil {
-		s.images = render.PaintRoots(true, s.roots...)
+		s.images = []image.Image{}
+		for _, r := range s.roots {
+			s.images = append(s.images, r.Paint(true, render.WithTracer(s.Tracer))...)
+		}
 	}
 
 	if len(s.images) == 0 {
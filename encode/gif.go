@@ -23,6 +23,9 @@ func (s *Screens) EncodeGIF(maxDuration int, filters ...ImageFilter) ([]byte, er
 		return []byte{}, nil
 	}
 
+	span := s.Tracer.Start("encode", "EncodeGIF").SetAttr("frames", len(images))
+	defer span.End()
+
 	g := &gif.GIF{}
 
 	remainingDuration := maxDuration
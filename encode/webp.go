@@ -21,6 +21,9 @@ func (s *Screens) EncodeWebP(maxDuration int, filters ...ImageFilter) ([]byte, e
 		return []byte{}, nil
 	}
 
+	span := s.Tracer.Start("encode", "EncodeWebP").SetAttr("frames", len(images))
+	defer span.End()
+
 	bounds := images[0].Bounds()
 	anim, err := webp.NewAnimationEncoder(
 		bounds.Dx(),
@@ -21,6 +21,7 @@ func init() {
 	rootCmd.AddCommand(cmd.RenderCmd)
 	rootCmd.AddCommand(cmd.PushCmd)
 	rootCmd.AddCommand(cmd.EncryptCmd)
+	rootCmd.AddCommand(cmd.KeysCmd)
 	rootCmd.AddCommand(cmd.VersionCmd)
 	rootCmd.AddCommand(cmd.ProfileCmd)
 	rootCmd.AddCommand(cmd.LoginCmd)
@@ -31,6 +32,10 @@ func init() {
 	rootCmd.AddCommand(cmd.LintCmd)
 	rootCmd.AddCommand(cmd.CheckCmd)
 	rootCmd.AddCommand(cmd.SetAuthCmd)
+	rootCmd.AddCommand(cmd.TestCmd)
+	rootCmd.AddCommand(cmd.ModulesCmd)
+	rootCmd.AddCommand(cmd.LockCmd)
+	rootCmd.AddCommand(cmd.ReplCmd)
 	rootCmd.AddCommand(community.CommunityCmd)
 }
 
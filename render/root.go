@@ -1,13 +1,16 @@
 package render
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"runtime"
+	"strings"
 	"sync"
 
 	"github.com/tidbyt/gg"
 	"tidbyt.dev/pixlet/globals"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 const (
@@ -50,6 +53,7 @@ type Root struct {
 
 	maxParallelFrames int
 	maxFrameCount     int
+	tracer            *tracing.Tracer
 }
 
 type RootPaintOption func(*Root)
@@ -74,6 +78,14 @@ func WithMaxFrameCount(max int) RootPaintOption {
 	}
 }
 
+// WithTracer records spans for painting the root, and each of its frames,
+// with t.
+func WithTracer(t *tracing.Tracer) RootPaintOption {
+	return func(r *Root) {
+		r.tracer = t
+	}
+}
+
 // Paint renders the child widget onto the frame. It doesn't do
 // any resizing or alignment.
 func (r Root) Paint(solidBackground bool, opts ...RootPaintOption) []image.Image {
@@ -85,10 +97,16 @@ func (r Root) Paint(solidBackground bool, opts ...RootPaintOption) []image.Image
 		r.maxFrameCount = DefaultMaxFrameCount
 	}
 
+	widget := strings.TrimPrefix(fmt.Sprintf("%T", r.Child), "*")
+
+	span := r.tracer.Start("render", "Root.Paint").SetAttr("widget", widget)
+	defer span.End()
+
 	numFrames := r.Child.FrameCount()
 	if numFrames > r.maxFrameCount {
 		numFrames = r.maxFrameCount
 	}
+	span.SetAttr("frames", numFrames)
 
 	frames := make([]image.Image, numFrames)
 
@@ -104,15 +122,25 @@ func (r Root) Paint(solidBackground bool, opts ...RootPaintOption) []image.Image
 		FrameHeight = globals.Height
 	}
 
+	// each slot is a frame being painted, and is traced as its own thread
+	// so that frames painted in parallel are shown side by side
 	var wg sync.WaitGroup
-	sem := make(chan bool, parallelism)
+	slots := make(chan int, parallelism)
+	for slot := 0; slot < parallelism; slot++ {
+		slots <- slot
+	}
 	for i := 0; i < numFrames; i++ {
 		wg.Add(1)
-		sem <- true
+		slot := <-slots
 
 		go func(i int) {
+			frameSpan := r.tracer.StartOnThread(tracing.MainThread+1+slot, "render", "frame").
+				SetAttr("frame", i).
+				SetAttr("widget", widget)
+
 			defer func() {
-				<-sem
+				frameSpan.End()
+				slots <- slot
 				wg.Done()
 			}()
 
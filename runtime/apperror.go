@@ -0,0 +1,190 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// ErrorKind classifies the errors raised by applets.
+type ErrorKind string
+
+const (
+	// ErrorKindSyntax is a Starlark file that couldn't be parsed or
+	// resolved, e.g. because of an undefined name.
+	ErrorKindSyntax ErrorKind = "syntax"
+
+	// ErrorKindRuntime is an error raised while running Starlark code.
+	ErrorKindRuntime ErrorKind = "runtime"
+
+	// ErrorKindTimeout is a run that was cancelled when its context's
+	// deadline passed.
+	ErrorKindTimeout ErrorKind = "timeout"
+
+	// ErrorKindModuleNotFound is a load() of a module or file that doesn't
+	// exist.
+	ErrorKindModuleNotFound ErrorKind = "module-not-found"
+
+	// ErrorKindSchema is an error in the applet's schema.
+	ErrorKindSchema ErrorKind = "schema"
+)
+
+// StackFrame is a frame of the Starlark call stack when an error was
+// raised. Builtin functions have a file of <builtin>, and no line or column.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int32  `json:"line,omitempty"`
+	Column   int32  `json:"column,omitempty"`
+}
+
+// AppError is an error raised by an applet's Starlark code, with where it
+// happened, for tools like editors to point at. File paths are relative to
+// the applet's root directory.
+//
+// Errors returned by NewApplet, Call and the methods that run the applet
+// wrap an AppError when the applet's code is at fault. Use AsAppError to get
+// it.
+type AppError struct {
+	Kind ErrorKind `json:"kind"`
+
+	// Message is the error, without the backtrace.
+	Message string `json:"message"`
+
+	File   string `json:"file,omitempty"`
+	Line   int32  `json:"line,omitempty"`
+	Column int32  `json:"column,omitempty"`
+
+	// Stack is the call stack, outermost call first.
+	Stack []StackFrame `json:"stack,omitempty"`
+
+	// Err is the error as it's shown to users, e.g. with a backtrace.
+	Err error `json:"-"`
+}
+
+func (e *AppError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// AsAppError returns the AppError wrapped by err. Errors that don't wrap one
+// are described as a runtime error without a position.
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	return &AppError{
+		Kind:    ErrorKindRuntime,
+		Message: err.Error(),
+		Err:     err,
+	}
+}
+
+// moduleNotFoundError is returned when loading a module that doesn't exist.
+type moduleNotFoundError struct {
+	module string
+}
+
+func (e *moduleNotFoundError) Error() string {
+	return fmt.Sprintf("invalid module: %s", e.module)
+}
+
+// newAppError describes err, which was raised while running the applet's
+// code with ctx, as an AppError wrapping reported, which is the error as it
+// should be shown to the user.
+func (a *Applet) newAppError(ctx context.Context, err error, reported error) *AppError {
+	appErr := &AppError{
+		Kind:    ErrorKindRuntime,
+		Message: err.Error(),
+		Err:     reported,
+	}
+
+	var (
+		syntaxErr   syntax.Error
+		resolveErrs resolve.ErrorList
+		evalErr     *starlark.EvalError
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		appErr.Kind = ErrorKindSyntax
+		appErr.Message = syntaxErr.Msg
+		appErr.File, appErr.Line, appErr.Column = a.position(syntaxErr.Pos)
+
+	case errors.As(err, &resolveErrs) && len(resolveErrs) > 0:
+		appErr.Kind = ErrorKindSyntax
+		appErr.Message = resolveErrs[0].Msg
+		appErr.File, appErr.Line, appErr.Column = a.position(resolveErrs[0].Pos)
+
+	case errors.As(err, &evalErr):
+		appErr.Message = evalErr.Msg
+		for _, fr := range evalErr.CallStack {
+			file, line, col := a.position(fr.Pos)
+			appErr.Stack = append(appErr.Stack, StackFrame{
+				Function: fr.Name,
+				File:     file,
+				Line:     line,
+				Column:   col,
+			})
+		}
+
+		// the error is reported where the innermost Starlark function
+		// was, which called any builtin that failed
+		for i := len(appErr.Stack) - 1; i >= 0; i-- {
+			if fr := appErr.Stack[i]; fr.Line > 0 {
+				appErr.File, appErr.Line, appErr.Column = fr.File, fr.Line, fr.Column
+				break
+			}
+		}
+	}
+
+	var notFound *moduleNotFoundError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		appErr.Kind = ErrorKindTimeout
+	case errors.As(err, &notFound) || errors.Is(err, fs.ErrNotExist):
+		appErr.Kind = ErrorKindModuleNotFound
+	}
+
+	appErr.Message = a.redactor.redact(appErr.Message)
+	return appErr
+}
+
+// schemaError returns an AppError for err, which was raised by the applet's
+// schema function fn. If err was raised by the applet's code, its position
+// is kept, otherwise the schema function's position is used.
+func (a *Applet) schemaError(fn *starlark.Function, err error) *AppError {
+	appErr := &AppError{
+		Kind:    ErrorKindSchema,
+		Message: err.Error(),
+		Err:     err,
+	}
+
+	var cause *AppError
+	if errors.As(err, &cause) {
+		appErr.Message = cause.Message
+		appErr.File, appErr.Line, appErr.Column = cause.File, cause.Line, cause.Column
+		appErr.Stack = cause.Stack
+	} else {
+		appErr.File, appErr.Line, appErr.Column = a.position(fn.Position())
+	}
+
+	return appErr
+}
+
+// position returns the path of pos relative to the applet's root directory,
+// along with its line and column.
+func (a *Applet) position(pos syntax.Position) (string, int32, int32) {
+	return strings.TrimPrefix(pos.Filename(), a.ID+"/"), pos.Line, pos.Col
+}
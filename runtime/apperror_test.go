@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+
+	"tidbyt.dev/pixlet/starlarkutil"
+)
+
+func TestAppErrorSyntax(t *testing.T) {
+	_, err := NewAppletFromFS("app", fstest.MapFS{
+		"app.star": {Data: []byte("def main():\n    return (\n")},
+	})
+	require.Error(t, err)
+
+	appErr := AsAppError(err)
+	assert.Equal(t, ErrorKindSyntax, appErr.Kind)
+	assert.Equal(t, "app.star", appErr.File)
+	assert.Equal(t, int32(3), appErr.Line)
+	assert.Contains(t, err.Error(), "starlark.ExecFile")
+
+	_, err = NewAppletFromFS("app", fstest.MapFS{
+		"app.star": {Data: []byte("def main():\n    return undefined_name\n")},
+	})
+	require.Error(t, err)
+
+	appErr = AsAppError(err)
+	assert.Equal(t, ErrorKindSyntax, appErr.Kind)
+	assert.Equal(t, "undefined: undefined_name", appErr.Message)
+	assert.Equal(t, int32(2), appErr.Line)
+	assert.Equal(t, int32(12), appErr.Column)
+}
+
+func TestAppErrorModuleNotFound(t *testing.T) {
+	for _, module := range []string{"nope.star", "./lib/missing.star"} {
+		_, err := NewAppletFromFS("app", fstest.MapFS{
+			"app.star":      {Data: []byte("load(\"lib/util.star\", \"x\")\ndef main():\n    return x\n")},
+			"lib/util.star": {Data: []byte("\n\nload(\"" + module + "\", \"y\")\nx = y\n")},
+		})
+		require.Error(t, err)
+
+		appErr := AsAppError(err)
+		assert.Equal(t, ErrorKindModuleNotFound, appErr.Kind, module)
+		assert.Equal(t, "lib/util.star", appErr.File, module)
+		assert.Equal(t, int32(3), appErr.Line, module)
+	}
+}
+
+func TestAppErrorRuntime(t *testing.T) {
+	app, err := NewAppletFromFS("app", fstest.MapFS{
+		"app.star": {Data: []byte(`
+load("lib.star", "check")
+
+def main():
+    return check(1)
+`)},
+		"lib.star": {Data: []byte(`
+def check(x):
+    if x:
+        fail("bad value", x)
+`)},
+	})
+	require.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Traceback")
+
+	appErr := AsAppError(err)
+	assert.Equal(t, ErrorKindRuntime, appErr.Kind)
+	assert.Equal(t, "fail: bad value 1", appErr.Message)
+	assert.Equal(t, "lib.star", appErr.File)
+	assert.Equal(t, int32(4), appErr.Line)
+	assert.Equal(t, []StackFrame{
+		{Function: "main", File: "app.star", Line: 5, Column: 17},
+		{Function: "check", File: "lib.star", Line: 4, Column: 13},
+		{Function: "fail", File: "<builtin>"},
+	}, appErr.Stack)
+}
+
+func TestAppErrorTimeout(t *testing.T) {
+	// wait blocks until the run's context is done, like an HTTP request
+	// that doesn't finish in time
+	wait := Module{
+		Name: "wait.star",
+		Load: func() (starlark.StringDict, error) {
+			return starlark.StringDict{
+				"wait": starlark.NewBuiltin("wait", func(thread *starlark.Thread, _ *starlark.Builtin, _ starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+					ctx := starlarkutil.ThreadContext(thread)
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}),
+			}, nil
+		},
+	}
+
+	app, err := NewAppletFromFS("app", fstest.MapFS{
+		"app.star": {Data: []byte(`
+load("wait.star", "wait")
+
+def main():
+    wait()
+`)},
+	}, WithModule(wait))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = app.Run(ctx)
+	require.Error(t, err)
+
+	appErr := AsAppError(err)
+	assert.Equal(t, ErrorKindTimeout, appErr.Kind)
+	assert.Equal(t, "app.star", appErr.File)
+	assert.Equal(t, int32(5), appErr.Line)
+}
+
+func TestAppErrorSchema(t *testing.T) {
+	_, err := NewAppletFromFS("app", fstest.MapFS{
+		"app.star": {Data: []byte(`
+load("schema.star", "schema")
+
+def main():
+    return []
+
+def get_schema():
+    return "not a schema"
+`)},
+	})
+	require.Error(t, err)
+
+	appErr := AsAppError(err)
+	assert.Equal(t, ErrorKindSchema, appErr.Kind)
+	assert.Equal(t, "app.star", appErr.File)
+	assert.Equal(t, int32(7), appErr.Line)
+}
@@ -3,6 +3,7 @@ package runtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"path"
@@ -10,36 +11,20 @@ import (
 	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
-	starlibbsoup "github.com/qri-io/starlib/bsoup"
-	starlibgzip "github.com/qri-io/starlib/compress/gzip"
-	starlibbase64 "github.com/qri-io/starlib/encoding/base64"
-	starlibcsv "github.com/qri-io/starlib/encoding/csv"
-	starlibhash "github.com/qri-io/starlib/hash"
-	starlibhtml "github.com/qri-io/starlib/html"
-	starlibre "github.com/qri-io/starlib/re"
-	starlibzip "github.com/qri-io/starlib/zipfile"
-	starlibjson "go.starlark.net/lib/json"
-	starlibmath "go.starlark.net/lib/math"
-	starlibtime "go.starlark.net/lib/time"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 	"go.starlark.net/starlarktest"
 	"go.starlark.net/syntax"
 
 	"tidbyt.dev/pixlet/render"
-	"tidbyt.dev/pixlet/runtime/modules/animation_runtime"
 	"tidbyt.dev/pixlet/runtime/modules/file"
-	"tidbyt.dev/pixlet/runtime/modules/hmac"
-	"tidbyt.dev/pixlet/runtime/modules/humanize"
-	"tidbyt.dev/pixlet/runtime/modules/qrcode"
 	"tidbyt.dev/pixlet/runtime/modules/random"
 	"tidbyt.dev/pixlet/runtime/modules/render_runtime"
-	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
-	"tidbyt.dev/pixlet/runtime/modules/sunrise"
-	"tidbyt.dev/pixlet/runtime/modules/xpath"
 	"tidbyt.dev/pixlet/schema"
 	"tidbyt.dev/pixlet/starlarkutil"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 type ModuleLoader func(*starlark.Thread, string) (starlark.StringDict, error)
@@ -56,9 +41,17 @@ type ThreadInitializer func(thread *starlark.Thread) *starlark.Thread
 type Applet struct {
 	ID string
 
-	loader       ModuleLoader
-	initializers []ThreadInitializer
-	loadedPaths  map[string]bool
+	loader         ModuleLoader
+	modules        *ModuleRegistry
+	libraryPath    []string
+	redactor       *secretRedactor
+	initializers   []ThreadInitializer
+	loadedPaths    map[string]bool
+	limits         Limits
+	clock          func() time.Time
+	validateConfig bool
+	loadDuration   time.Duration
+	tracer         *tracing.Tracer
 
 	globals map[string]starlark.StringDict
 
@@ -105,6 +98,27 @@ func WithPrintDisabled() AppletOption {
 	return WithPrintFunc(func(thread *starlark.Thread, msg string) {})
 }
 
+// WithClock makes clock the source of the current time for the applet. It's
+// used by time.now(), by the sunrise and humanize modules when they need the
+// current time, and to seed the random module.
+func WithClock(clock func() time.Time) AppletOption {
+	return func(a *Applet) error {
+		a.clock = clock
+		return nil
+	}
+}
+
+// WithTracer records spans of the applet's work with t, such as loading its
+// files, calling its functions, and the HTTP requests and widgets that they
+// make. Contexts passed to the applet that carry a tracer are traced with it
+// instead.
+func WithTracer(t *tracing.Tracer) AppletOption {
+	return func(a *Applet) error {
+		a.tracer = t
+		return nil
+	}
+}
+
 func NewApplet(id string, src []byte, opts ...AppletOption) (*Applet, error) {
 	fn := id
 	if !strings.HasSuffix(fn, ".star") {
@@ -121,8 +135,37 @@ func NewApplet(id string, src []byte, opts ...AppletOption) (*Applet, error) {
 }
 
 func NewAppletFromFS(id string, fsys fs.FS, opts ...AppletOption) (*Applet, error) {
+	a, err := newApplet(id, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.libraryPath != nil {
+		lfs, err := NewLibraryFS(fsys, a.libraryPath)
+		if err != nil {
+			return nil, err
+		}
+		fsys = lfs
+	}
+
+	span := a.tracer.Start("starlark", "load").SetAttr("app", id)
+	start := time.Now()
+	err = a.load(fsys)
+	a.loadDuration = time.Since(start)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// newApplet returns an applet with opts applied, which hasn't loaded any
+// files yet.
+func newApplet(id string, opts ...AppletOption) (*Applet, error) {
 	a := &Applet{
 		ID:          id,
+		modules:     DefaultModules.Clone(),
 		globals:     make(map[string]starlark.StringDict),
 		loadedPaths: make(map[string]bool),
 	}
@@ -133,10 +176,6 @@ func NewAppletFromFS(id string, fsys fs.FS, opts ...AppletOption) (*Applet, erro
 		}
 	}
 
-	if err := a.load(fsys); err != nil {
-		return nil, err
-	}
-
 	return a, nil
 }
 
@@ -149,6 +188,14 @@ func (a *Applet) Run(ctx context.Context) (roots []render.Root, err error) {
 // RunWithConfig exceutes the applet's main function, passing it configuration as a
 // starlark dict. It returns the render roots that are returned by the applet.
 func (a *Applet) RunWithConfig(ctx context.Context, config map[string]string) (roots []render.Root, err error) {
+	if a.validateConfig {
+		var violations []ConfigViolation
+		config, violations = a.ValidateConfig(config)
+		if len(violations) > 0 {
+			return nil, &ConfigValidationError{Violations: violations}
+		}
+	}
+
 	var args starlark.Tuple
 	if a.mainFun.NumParams() > 0 {
 		starlarkConfig := AppletConfig(config)
@@ -184,6 +231,10 @@ func (a *Applet) RunWithConfig(ctx context.Context, config map[string]string) (r
 		return nil, fmt.Errorf("expected app implementation to return Root(s) but found: %s", returnValue.Type())
 	}
 
+	if err := a.checkFrameLimit(roots); err != nil {
+		return nil, err
+	}
+
 	return roots, nil
 }
 
@@ -246,6 +297,71 @@ func (app *Applet) RunTests(t *testing.T) {
 		return thread
 	})
 
+	for _, test := range app.testFunctions() {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := app.Call(context.Background(), test.fun); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestResult is the outcome of running one of the applet's test functions.
+type TestResult struct {
+	// Name identifies the test as file/function.
+	Name string
+
+	// Failures holds the errors reported by the assert module, followed by
+	// the error the test failed with, if any. Each includes a backtrace.
+	Failures []string
+
+	Duration time.Duration
+}
+
+// Passed reports whether the test passed.
+func (r *TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// RunTestFunctions runs the applet's test functions without needing a Go test
+// harness. Tests are run in order of file and function name, and only those
+// whose name is accepted by match are run. If match is nil, all tests are run.
+func (app *Applet) RunTestFunctions(ctx context.Context, match func(name string) bool) []*TestResult {
+	var results []*TestResult
+
+	for _, test := range app.testFunctions() {
+		if match != nil && !match(test.name) {
+			continue
+		}
+
+		reporter := &testReporter{}
+		result := &TestResult{Name: test.name}
+
+		start := time.Now()
+		_, err := app.Call(context.WithValue(ctx, testReporterContextKey{}, reporter), test.fun)
+		result.Duration = time.Since(start)
+
+		result.Failures = reporter.failures
+		if err != nil {
+			result.Failures = append(result.Failures, err.Error())
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+type testFunction struct {
+	name string
+	fun  *starlark.Function
+}
+
+// testFunctions returns all functions whose name starts with test_, sorted
+// by name.
+func (app *Applet) testFunctions() []testFunction {
+	var tests []testFunction
+
 	for file, globals := range app.globals {
 		for name, global := range globals {
 			if !strings.HasPrefix(name, "test_") {
@@ -253,14 +369,30 @@ func (app *Applet) RunTests(t *testing.T) {
 			}
 
 			if fun, ok := global.(*starlark.Function); ok {
-				t.Run(fmt.Sprintf("%s/%s", file, name), func(t *testing.T) {
-					if _, err := app.Call(context.Background(), fun); err != nil {
-						t.Error(err)
-					}
+				tests = append(tests, testFunction{
+					name: fmt.Sprintf("%s/%s", file, name),
+					fun:  fun,
 				})
 			}
 		}
 	}
+
+	slices.SortFunc(tests, func(a, b testFunction) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	return tests
+}
+
+type testReporterContextKey struct{}
+
+// testReporter collects the errors reported by the assert module.
+type testReporter struct {
+	failures []string
+}
+
+func (r *testReporter) Error(args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprint(args...))
 }
 
 // Calls any callable from Applet.Globals. Pass args and receive a
@@ -272,6 +404,9 @@ func (a *Applet) Call(ctx context.Context, callable *starlark.Function, args ...
 		}
 	}()
 
+	span := a.tracerFor(ctx).Start("starlark", callable.Name())
+	defer span.End()
+
 	t := a.newThread(ctx)
 	defer starlarkutil.RunOnExitFuncs(t)
 
@@ -281,16 +416,27 @@ func (a *Applet) Call(ctx context.Context, callable *starlark.Function, args ...
 
 	resultVal, err := starlark.Call(t, callable, args, nil)
 	if err != nil {
+		var reported error
 		evalErr, ok := err.(*starlark.EvalError)
 		if ok {
-			return nil, fmt.Errorf(evalErr.Backtrace())
+			reported = fmt.Errorf(evalErr.Backtrace())
+		} else {
+			reported = fmt.Errorf(
+				"in %s at %s: %s",
+				callable.Name(),
+				callable.Position().String(),
+				err,
+			)
 		}
-		return nil, fmt.Errorf(
-			"in %s at %s: %s",
-			callable.Name(),
-			callable.Position().String(),
-			err,
-		)
+
+		if limitErr := a.limitExceeded(t, err, reported); limitErr != nil {
+			return nil, a.newAppError(ctx, err, limitErr)
+		}
+
+		if a.redactor != nil {
+			reported = errors.New(a.redactor.redact(reported.Error()))
+		}
+		return nil, a.newAppError(ctx, err, reported)
 	}
 
 	return resultVal, nil
@@ -331,6 +477,33 @@ func (a *Applet) load(fsys fs.FS) (err error) {
 	return nil
 }
 
+// LoadError is returned when a file in the applet fails to load. Chain lists
+// the files that led to the failure, starting with a file in the applet's
+// root directory and ending with the file that failed.
+type LoadError struct {
+	Chain []string
+	Err   error
+}
+
+func newLoadError(currentlyLoading []string, next string, err error) *LoadError {
+	chain := slices.Clone(currentlyLoading)
+	if next != "" {
+		chain = append(chain, next)
+	}
+	return &LoadError{Chain: chain, Err: err}
+}
+
+func (e *LoadError) Error() string {
+	if len(e.Chain) < 2 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (load chain: %s)", e.Err, strings.Join(e.Chain, " -> "))
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
 func (a *Applet) ensureLoaded(fsys fs.FS, pathToLoad string, currentlyLoading ...string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -347,7 +520,7 @@ func (a *Applet) ensureLoaded(fsys fs.FS, pathToLoad string, currentlyLoading ..
 
 	// use the currentlyLoading slice to detect circular dependencies
 	if slices.Contains(currentlyLoading, pathToLoad) {
-		return fmt.Errorf("circular dependency detected: %s -> %s", strings.Join(currentlyLoading, " -> "), pathToLoad)
+		return newLoadError(currentlyLoading, pathToLoad, fmt.Errorf("circular dependency detected"))
 	} else {
 		// mark this file as currently loading. if we encounter it again,
 		// we have a circular dependency.
@@ -358,9 +531,12 @@ func (a *Applet) ensureLoaded(fsys fs.FS, pathToLoad string, currentlyLoading ..
 		a.loadedPaths[pathToLoad] = true
 	}
 
+	span := a.tracer.Start("starlark", "exec").SetAttr("file", pathToLoad)
+	defer span.End()
+
 	src, err := fs.ReadFile(fsys, pathToLoad)
 	if err != nil {
-		return fmt.Errorf("reading %s: %v", pathToLoad, err)
+		return newLoadError(currentlyLoading, "", fmt.Errorf("reading %s: %w", pathToLoad, err))
 	}
 
 	predeclared := starlark.StringDict{
@@ -375,8 +551,31 @@ func (a *Applet) ensureLoaded(fsys fs.FS, pathToLoad string, currentlyLoading ..
 		// normalize module path
 		modulePath := path.Clean(module)
 
+		// paths starting with ./ or ../ are relative to the loading file,
+		// and must be in the applet's filesystem
+		relative := strings.HasPrefix(module, "./") || strings.HasPrefix(module, "../")
+		if relative {
+			modulePath = path.Join(path.Dir(pathToLoad), module)
+			if modulePath == ".." || strings.HasPrefix(modulePath, "../") {
+				return nil, newLoadError(currentlyLoading, module, fmt.Errorf("%s is outside of the app", module))
+			}
+			if err := checkLibraryLoad(pathToLoad, modulePath, module); err != nil {
+				return nil, newLoadError(currentlyLoading, module, err)
+			}
+		}
+
+		// paths like @teamlib//weather.star are files in a shared library,
+		// which are found in the @teamlib directory of a LibraryFS
+		library := strings.HasPrefix(module, "@")
+		if library {
+			var err error
+			if modulePath, err = parseLibraryLabel(module); err != nil {
+				return nil, newLoadError(currentlyLoading, module, err)
+			}
+		}
+
 		// if the module exists on the filesystem, load it
-		if _, err := fs.Stat(fsys, modulePath); err == nil {
+		if _, err := fs.Stat(fsys, modulePath); err == nil || relative || library {
 			// ensure the module is loaded, and pass the currentlyLoading slice
 			// to detect circular dependencies
 			if err := a.ensureLoaded(fsys, modulePath, currentlyLoading...); err != nil {
@@ -407,7 +606,28 @@ func (a *Applet) ensureLoaded(fsys fs.FS, pathToLoad string, currentlyLoading ..
 			predeclared,
 		)
 		if err != nil {
-			return fmt.Errorf("starlark.ExecFile: %v", err)
+			if limitErr := a.limitExceeded(thread, err, err); limitErr != nil {
+				return a.newAppError(context.Background(), err, fmt.Errorf("starlark.ExecFile: %w", limitErr))
+			}
+
+			// if a file loaded by this one failed, report that failure, which
+			// carries the full load chain. if it failed before running any
+			// code, e.g. because it doesn't exist, it's reported at the
+			// load() in this file
+			var loadErr *LoadError
+			if errors.As(err, &loadErr) {
+				var appErr *AppError
+				if !errors.As(loadErr.Err, &appErr) {
+					loadErr.Err = a.newAppError(context.Background(), err, loadErr.Err)
+				}
+				return loadErr
+			}
+
+			return newLoadError(currentlyLoading, "", a.newAppError(
+				context.Background(),
+				err,
+				fmt.Errorf("starlark.ExecFile: %s", a.redactor.redact(err.Error())),
+			))
 		}
 		a.globals[pathToLoad] = globals
 
@@ -432,12 +652,12 @@ func (a *Applet) ensureLoaded(fsys fs.FS, pathToLoad string, currentlyLoading ..
 
 			schemaVal, err := a.Call(context.Background(), schemaFun)
 			if err != nil {
-				return fmt.Errorf("calling schema function for %s: %w", a.ID, err)
+				return a.schemaError(schemaFun, fmt.Errorf("calling schema function for %s: %w", a.ID, err))
 			}
 
 			a.Schema, err = schema.FromStarlark(schemaVal, globals)
 			if err != nil {
-				return fmt.Errorf("parsing schema for %s: %w", a.ID, err)
+				return a.schemaError(schemaFun, fmt.Errorf("parsing schema for %s: %w", a.ID, err))
 			}
 
 			a.SchemaJSON, err = json.Marshal(a.Schema)
@@ -467,16 +687,41 @@ func (a *Applet) newThread(ctx context.Context) *starlark.Thread {
 		},
 	}
 
+	if tracing.FromContext(ctx) == nil && a.tracer != nil {
+		ctx = tracing.NewContext(ctx, a.tracer)
+	}
+
 	starlarkutil.AttachThreadContext(ctx, t)
+	if a.clock != nil {
+		starlarkutil.AttachThreadClock(t, a.clock)
+	}
 	random.AttachToThread(t)
 
 	for _, init := range a.initializers {
 		t = init(t)
 	}
 
+	attachRunRecorder(ctx, t)
+
+	if a.redactor != nil {
+		a.redactor.attachToThread(t)
+	}
+
+	if reporter, ok := ctx.Value(testReporterContextKey{}).(*testReporter); ok {
+		starlarktest.SetReporter(t, reporter)
+	}
+
 	return t
 }
 
+// tracerFor returns the tracer for work done with ctx.
+func (a *Applet) tracerFor(ctx context.Context) *tracing.Tracer {
+	if t := tracing.FromContext(ctx); t != nil {
+		return t
+	}
+	return a.tracer
+}
+
 func (a *Applet) loadModule(thread *starlark.Thread, module string) (starlark.StringDict, error) {
 	if a.loader != nil {
 		mod, err := a.loader(thread, module)
@@ -485,98 +730,9 @@ func (a *Applet) loadModule(thread *starlark.Thread, module string) (starlark.St
 		}
 	}
 
-	switch module {
-	case "render.star":
-		return render_runtime.LoadRenderModule()
-
-	case "animation.star":
-		return animation_runtime.LoadAnimationModule()
-
-	case "schema.star":
-		return schema.LoadModule()
-
-	case "cache.star":
-		return LoadCacheModule()
-
-	case "secret.star":
-		return LoadSecretModule()
-
-	case "xpath.star":
-		return xpath.LoadXPathModule()
-
-	case "bsoup.star":
-		return starlibbsoup.LoadModule()
-
-	case "compress/gzip.star":
-		return starlark.StringDict{
-			starlibgzip.Module.Name: starlibgzip.Module,
-		}, nil
-
-	case "compress/zipfile.star":
-		// Starlib expects you to load the ZipFile function directly, rather than having it be part of a namespace.
-		// Wraps this to be more consistent with other pixlet modules, as follows:
-		//   load("compress/zipfile.star", "zipfile")
-		//   archive = zipfile.ZipFile("/tmp/foo.zip")
-		m, _ := starlibzip.LoadModule()
-		return starlark.StringDict{
-			"zipfile": &starlarkstruct.Module{
-				Name:    "zipfile",
-				Members: m,
-			},
-		}, nil
-
-	case "encoding/base64.star":
-		return starlibbase64.LoadModule()
-
-	case "encoding/csv.star":
-		return starlibcsv.LoadModule()
-
-	case "encoding/json.star":
-		return starlark.StringDict{
-			starlibjson.Module.Name: starlibjson.Module,
-		}, nil
-
-	case "hash.star":
-		return starlibhash.LoadModule()
-
-	case "hmac.star":
-		return hmac.LoadModule()
-
-	case "http.star":
-		return starlarkhttp.LoadModule()
-
-	case "html.star":
-		return starlibhtml.LoadModule()
-
-	case "humanize.star":
-		return humanize.LoadModule()
-
-	case "math.star":
-		return starlark.StringDict{
-			starlibmath.Module.Name: starlibmath.Module,
-		}, nil
-
-	case "re.star":
-		return starlibre.LoadModule()
-
-	case "sunrise.star":
-		return sunrise.LoadModule()
-
-	case "time.star":
-		return starlark.StringDict{
-			starlibtime.Module.Name: starlibtime.Module,
-		}, nil
-
-	case "random.star":
-		return random.LoadModule()
-
-	case "qrcode.star":
-		return qrcode.LoadModule()
-
-	case "assert.star":
-		return starlarktest.LoadAssertModule()
-
-	default:
-		return nil, fmt.Errorf("invalid module: %s", module)
+	if m, ok := a.modules.Lookup(module); ok {
+		return m.Load()
 	}
+
+	return nil, &moduleNotFoundError{module: module}
 }
@@ -6,8 +6,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	starlibbase64 "github.com/qri-io/starlib/encoding/base64"
 	"github.com/stretchr/testify/assert"
@@ -177,6 +180,67 @@ def main(config):
 	assert.Equal(t, 3, len(roots))
 }
 
+func TestConfigTypedAccessors(t *testing.T) {
+	config := map[string]string{
+		"count":    " 42 ",
+		"ratio":    "0.25",
+		"data":     `{"a": [1, 2], "b": null}`,
+		"color":    "#FF00aa",
+		"short":    "f0a",
+		"location": `{"lat": "40.6781784", "lng": -73.9441579, "description": "Brooklyn, NY, USA", "locality": "Brooklyn", "place_id": "ChIJCSF8lBZEwokRhngABHRcdoI", "timezone": "America/New_York"}`,
+		"when":     "2026-12-31T23:59:50-05:00",
+		"empty":    "",
+		"bad":      "not { valid",
+		"bad_loc":  `{"lat": "north", "lng": "0", "timezone": "UTC"}`,
+		"bad_tz":   `{"lat": "0", "lng": "0", "timezone": "Mars/Olympus_Mons"}`,
+	}
+
+	src := `
+load("assert.star", "assert")
+load("render.star", "render")
+load("time.star", "time")
+
+def main(config):
+    assert.eq(config.int("count"), 42)
+    assert.eq(config.int("doesnt_exist"), None)
+    assert.eq(config.int("doesnt_exist", 7), 7)
+    assert.eq(config.int("empty", 7), 7)
+    assert.eq(config.int("ratio", 7), 7)
+    assert.eq(config.int("bad", 7), 7)
+
+    assert.eq(config.float("ratio"), 0.25)
+    assert.eq(config.float("count"), 42.0)
+    assert.eq(config.float("bad", 1.5), 1.5)
+
+    assert.eq(config.json("data"), {"a": [1, 2], "b": None})
+    assert.eq(config.json("bad", {}), {})
+
+    assert.eq(config.color("color"), "#ff00aa")
+    assert.eq(config.color("short"), "#f0a")
+    assert.eq(config.color("bad", "#000"), "#000")
+
+    loc = config.location("location")
+    assert.eq(loc.lat, 40.6781784)
+    assert.eq(loc.lng, -73.9441579)
+    assert.eq(loc.timezone, "America/New_York")
+    assert.eq(loc.locality, "Brooklyn")
+    assert.eq(config.location("bad_loc"), None)
+    assert.eq(config.location("bad_tz"), None)
+    assert.eq(config.location("count", "default"), "default")
+
+    when = config.datetime("when")
+    assert.eq(when, time.parse_time("2026-12-31T23:59:50-05:00"))
+    assert.eq(config.datetime("bad"), None)
+
+    return render.Root(child=render.Box())
+`
+	app, err := NewApplet("test.star", []byte(src))
+	require.NoError(t, err)
+
+	_, err = app.RunWithConfig(context.Background(), config)
+	assert.NoError(t, err)
+}
+
 func TestLoadMultipleFiles(t *testing.T) {
 	mainSrc := `
 load("render.star", "render")
@@ -352,6 +416,88 @@ def b():
 	assert.ErrorContains(t, err, "circular dependency")
 }
 
+func TestRelativeLoad(t *testing.T) {
+	src := `
+load("render.star", "render")
+load("lib/weather/api.star", "api")
+
+def main():
+    if api.forecast() != "sunny, 21°":
+        fail("something went wrong")
+    return render.Root(child=render.Box())
+`
+
+	apiSrc := `
+load("./parse.star", "parse")
+load("../common.star", "common")
+
+def _forecast():
+    return common.format(parse.parse())
+
+api = struct(forecast = _forecast)
+`
+
+	parseSrc := `
+def _parse():
+    return ("sunny", 21)
+
+parse = struct(parse = _parse)
+`
+
+	commonSrc := `
+def _format(weather):
+    return "%s, %d°" % weather
+
+common = struct(format = _format)
+`
+
+	vfs := fstest.MapFS{
+		"app.star":               {Data: []byte(src)},
+		"lib/weather/api.star":   {Data: []byte(apiSrc)},
+		"lib/weather/parse.star": {Data: []byte(parseSrc)},
+		"lib/common.star":        {Data: []byte(commonSrc)},
+		"lib/unused.star":        {Data: []byte(`fail("not loaded")`)},
+	}
+
+	app, err := NewAppletFromFS("test", vfs)
+	require.NoError(t, err)
+	roots, err := app.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(roots))
+
+	paths := app.PathsForBundle()
+	slices.Sort(paths)
+	assert.Equal(t, []string{
+		"app.star",
+		"lib/common.star",
+		"lib/weather/api.star",
+		"lib/weather/parse.star",
+	}, paths)
+
+	// relative loads can't escape the app
+	vfs["lib/common.star"] = &fstest.MapFile{Data: []byte(`load("../../secrets.star", "secrets")`)}
+	_, err = NewAppletFromFS("test", vfs)
+	assert.ErrorContains(t, err, "../../secrets.star is outside of the app")
+
+	// errors report the chain of loads that led to them
+	vfs["lib/common.star"] = &fstest.MapFile{Data: []byte(`load("./missing.star", "missing")`)}
+	_, err = NewAppletFromFS("test", vfs)
+	var loadErr *LoadError
+	require.ErrorAs(t, err, &loadErr)
+	assert.Equal(t, []string{
+		"app.star",
+		"lib/weather/api.star",
+		"lib/common.star",
+		"lib/missing.star",
+	}, loadErr.Chain)
+	assert.ErrorContains(t, err, "(load chain: app.star -> lib/weather/api.star -> lib/common.star -> lib/missing.star)")
+
+	// relative loads never fall back to built-in modules
+	vfs["lib/common.star"] = &fstest.MapFile{Data: []byte(`load("./render.star", "render")`)}
+	_, err = NewAppletFromFS("test", vfs)
+	assert.ErrorContains(t, err, "reading lib/render.star")
+}
+
 func TestTimezoneDatabase(t *testing.T) {
 	src := `
 load("render.star", "render")
@@ -369,6 +515,42 @@ def main():
 	assert.NoError(t, err)
 }
 
+func TestWithClock(t *testing.T) {
+	src := `
+load("assert.star", "assert")
+load("humanize.star", "humanize")
+load("random.star", "random")
+load("render.star", "render")
+load("sunrise.star", "sunrise")
+load("time.star", "time")
+
+def main():
+    now = time.now()
+    assert.eq(now, time.parse_time("2026-12-31T23:59:50-05:00"))
+    assert.eq(humanize.time(now - time.parse_duration("3m")), "3 minutes ago")
+    assert.eq(humanize.relative_time(now + time.parse_duration("10s"), label_a = "from now", label_b = "ago"), "10 seconds ago")
+
+    # sunrise on the clock's date in New York
+    rise = sunrise.sunrise(40.7, -74.0)
+    assert.eq(rise.in_location("America/New_York").format("2006-01-02"), "2026-12-31")
+
+    return render.Root(child=render.Text(str(random.number(0, 1000000))))
+`
+	at, err := time.Parse(time.RFC3339, "2026-12-31T23:59:50-05:00")
+	require.NoError(t, err)
+
+	app, err := NewApplet("test.star", []byte(src), WithClock(func() time.Time { return at }))
+	require.NoError(t, err)
+
+	roots, err := app.Run(context.Background())
+	require.NoError(t, err)
+
+	// the random seed is derived from the clock, so it doesn't change
+	roots2, err := app.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, roots[0].Child, roots2[0].Child)
+}
+
 func TestZIPModule(t *testing.T) {
 	// Create a new zip file to read from starlark
 	// https://go.dev/src/archive/zip/example_test.go
@@ -453,4 +635,55 @@ def main():
 	app.RunTests(t)
 }
 
+func TestRunTestFunctions(t *testing.T) {
+	src := `
+load("assert.star", "assert")
+
+def double(x):
+    return x * 2
+
+def test_double():
+    assert.eq(double(2), 4)
+
+def test_double_string():
+    assert.eq(double("ab"), "ab")
+    assert.eq(double("cd"), "cd")
+
+def test_fails():
+    double(None)
+
+def helper_not_a_test():
+    fail("should not run")
+
+def main():
+    pass
+`
+	app, err := NewApplet("test.star", []byte(src))
+	require.NoError(t, err)
+
+	results := app.RunTestFunctions(context.Background(), nil)
+	require.Len(t, results, 3)
+
+	assert.Equal(t, "test.star/test_double", results[0].Name)
+	assert.True(t, results[0].Passed())
+
+	assert.Equal(t, "test.star/test_double_string", results[1].Name)
+	assert.False(t, results[1].Passed())
+	require.Len(t, results[1].Failures, 2)
+	assert.Contains(t, results[1].Failures[0], `"abab" != "ab"`)
+	assert.Contains(t, results[1].Failures[0], "test.star:11:14: in test_double_string")
+	assert.Contains(t, results[1].Failures[1], `"cdcd" != "cd"`)
+
+	assert.Equal(t, "test.star/test_fails", results[2].Name)
+	require.Len(t, results[2].Failures, 1)
+	assert.Contains(t, results[2].Failures[0], "in double")
+	assert.Contains(t, results[2].Failures[0], "unknown binary op: NoneType * int")
+
+	results = app.RunTestFunctions(context.Background(), func(name string) bool {
+		return strings.HasSuffix(name, "/test_double")
+	})
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Passed())
+}
+
 // TODO: test Screens, especially Screens.Render()
@@ -1,13 +1,18 @@
 package runtime
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
+
+	"tidbyt.dev/pixlet/starlarkutil"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 const DefaultExpirationSeconds = 60
@@ -17,6 +22,35 @@ type Cache interface {
 	Get(thread *starlark.Thread, key string) ([]byte, bool, error)
 }
 
+// CacheDeleter is implemented by caches that can delete records. Records in
+// caches that don't implement it are deleted by setting them with a negative
+// TTL, which must cause them to expire immediately.
+type CacheDeleter interface {
+	Delete(thread *starlark.Thread, key string) error
+}
+
+// CacheTTLGetter is implemented by caches that can report how long a record
+// has left before it expires. A negative TTL means the record never expires.
+// For caches that don't implement it, the TTL of existing records is reported
+// as zero.
+type CacheTTLGetter interface {
+	TTL(thread *starlark.Thread, key string) (ttl int64, found bool, err error)
+}
+
+// CacheIncrementer is implemented by caches that can atomically increment an
+// integer record. If the record doesn't exist, it's created with the given
+// TTL and a value of delta. The TTL of an existing record is left untouched.
+//
+// Caches that don't implement it are incremented with a Get followed by a
+// Set, which is only atomic within a single process and resets the TTL.
+type CacheIncrementer interface {
+	Incr(thread *starlark.Thread, key string, delta int64, ttl int64) (int64, error)
+}
+
+// ErrCacheValueNotInteger is returned when incrementing a record that doesn't
+// hold an integer.
+var ErrCacheValueNotInteger = errors.New("cached value is not an integer")
+
 type InMemoryCacheRecord struct {
 	data       []byte
 	expiration time.Time
@@ -60,6 +94,124 @@ func (c *InMemoryCache) Set(_ *starlark.Thread, key string, value []byte, ttl in
 	return nil
 }
 
+func (c *InMemoryCache) Delete(_ *starlark.Thread, key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.records, key)
+
+	return nil
+}
+
+func (c *InMemoryCache) TTL(_ *starlark.Thread, key string) (int64, bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	r, found := c.records[key]
+	if !found {
+		return 0, false, nil
+	}
+
+	remaining := time.Until(r.expiration)
+	if remaining <= 0 {
+		return 0, false, nil
+	}
+
+	return ceilSeconds(remaining), true, nil
+}
+
+func (c *InMemoryCache) Incr(_ *starlark.Thread, key string, delta int64, ttl int64) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r, found := c.records[key]
+	if !found || time.Now().After(r.expiration) {
+		r = &InMemoryCacheRecord{
+			expiration: time.Now().Add(time.Duration(ttl) * time.Second),
+		}
+		c.records[key] = r
+	}
+
+	n, err := incrValue(r.data, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	r.data = []byte(strconv.FormatInt(n, 10))
+
+	return n, nil
+}
+
+// incrValue parses a cached integer and adds delta to it. An empty value is
+// treated as zero.
+func incrValue(value []byte, delta int64) (int64, error) {
+	if len(value) == 0 {
+		return delta, nil
+	}
+
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, ErrCacheValueNotInteger
+	}
+
+	return n + delta, nil
+}
+
+// ceilSeconds converts a duration to a number of seconds, rounding up so that
+// a record that is about to expire still reports a TTL of one second.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+var (
+	// incrMutex serializes increments for caches that don't implement
+	// CacheIncrementer.
+	incrMutex sync.Mutex
+)
+
+func cacheDelete(thread *starlark.Thread, key string) error {
+	if d, ok := cache.(CacheDeleter); ok {
+		return d.Delete(thread, key)
+	}
+
+	return cache.Set(thread, key, nil, -1)
+}
+
+func cacheTTL(thread *starlark.Thread, key string) (int64, bool, error) {
+	if t, ok := cache.(CacheTTLGetter); ok {
+		return t.TTL(thread, key)
+	}
+
+	// without native support, all we can tell is whether the record exists
+	_, found, err := cache.Get(thread, key)
+	return 0, found, err
+}
+
+func cacheIncr(thread *starlark.Thread, key string, delta int64, ttl int64) (int64, error) {
+	if i, ok := cache.(CacheIncrementer); ok {
+		return i.Incr(thread, key, delta, ttl)
+	}
+
+	incrMutex.Lock()
+	defer incrMutex.Unlock()
+
+	val, _, err := cache.Get(thread, key)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := incrValue(val, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := cache.Set(thread, key, []byte(strconv.FormatInt(n, 10)), ttl); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
 var (
 	cacheOnce   sync.Once
 	cacheModule starlark.StringDict
@@ -76,8 +228,12 @@ func LoadCacheModule() (starlark.StringDict, error) {
 			"cache": &starlarkstruct.Module{
 				Name: "cache",
 				Members: starlark.StringDict{
-					"get": starlark.NewBuiltin("get", cacheGet),
-					"set": starlark.NewBuiltin("set", cacheSet),
+					"get":        starlark.NewBuiltin("get", cacheGet),
+					"set":        starlark.NewBuiltin("set", cacheSet),
+					"delete":     starlark.NewBuiltin("delete", cacheDeleteBuiltin),
+					"ttl":        starlark.NewBuiltin("ttl", cacheTTLBuiltin),
+					"incr":       starlark.NewBuiltin("incr", cacheIncrBuiltin),
+					"get_or_set": starlark.NewBuiltin("get_or_set", cacheGetOrSet),
 				},
 			},
 		}
@@ -108,7 +264,10 @@ func cacheGet(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple,
 		return starlark.None, nil
 	}
 
+	span := tracing.FromContext(starlarkutil.ThreadContext(thread)).Start("cache", "cache.get")
 	val, found, err := cache.Get(thread, cacheKey)
+	span.SetAttr("key", key.GoString()).SetAttr("hit", found && err == nil).End()
+	recordCacheOperation(thread, CacheOperationRecord{Operation: "get", Key: key.GoString(), Hit: found && err == nil})
 
 	if err != nil {
 		// don't fail just because cache is misbehaving
@@ -142,28 +301,201 @@ func cacheSet(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple,
 
 	cacheKey := scopedCacheKey(thread, key)
 
-	ttl64, ok := ttl.Int64()
-	if !ok {
-		return nil, fmt.Errorf("ttl_seconds must be valid integer (not %s)", ttl.String())
+	ttl64, err := ttlSeconds(ttl)
+	if err != nil {
+		return nil, err
 	}
 
-	if ttl64 < 0 {
-		return nil, fmt.Errorf("ttl_seconds cannot be negative")
+	if cache == nil {
+		// no cache configured
+		return starlark.None, nil
 	}
 
-	if ttl64 == 0 {
-		ttl64 = DefaultExpirationSeconds
+	span := tracing.FromContext(starlarkutil.ThreadContext(thread)).Start("cache", "cache.set")
+	err = cache.Set(thread, cacheKey, []byte(val.GoString()), ttl64)
+	span.SetAttr("key", key.GoString()).End()
+	recordCacheOperation(thread, CacheOperationRecord{Operation: "set", Key: key.GoString(), TTL: ttl64})
+	if err != nil {
+		log.Printf("setting %s in cache: %v", cacheKey, err)
+	}
+
+	return starlark.None, nil
+}
+
+func cacheDeleteBuiltin(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key starlark.String
+
+	if err := starlark.UnpackArgs(
+		"delete",
+		args, kwargs,
+		"key", &key,
+	); err != nil {
+		return nil, fmt.Errorf("unpacking arguments for cache.delete: %v", err)
 	}
 
+	cacheKey := scopedCacheKey(thread, key)
+
 	if cache == nil {
 		// no cache configured
 		return starlark.None, nil
 	}
 
-	err := cache.Set(thread, cacheKey, []byte(val.GoString()), ttl64)
-	if err != nil {
-		log.Printf("setting %s in cache: %v", cacheKey, err)
+	recordCacheOperation(thread, CacheOperationRecord{Operation: "delete", Key: key.GoString()})
+	if err := cacheDelete(thread, cacheKey); err != nil {
+		log.Printf("deleting %s from cache: %v", cacheKey, err)
 	}
 
 	return starlark.None, nil
 }
+
+func cacheTTLBuiltin(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key starlark.String
+
+	if err := starlark.UnpackArgs(
+		"ttl",
+		args, kwargs,
+		"key", &key,
+	); err != nil {
+		return nil, fmt.Errorf("unpacking arguments for cache.ttl: %v", err)
+	}
+
+	cacheKey := scopedCacheKey(thread, key)
+
+	if cache == nil {
+		// no cache configured
+		return starlark.None, nil
+	}
+
+	ttl, found, err := cacheTTL(thread, cacheKey)
+	if err != nil {
+		log.Printf("getting TTL of %s from cache: %v", cacheKey, err)
+		return starlark.None, nil
+	}
+
+	if !found {
+		return starlark.None, nil
+	}
+
+	return starlark.MakeInt64(ttl), nil
+}
+
+func cacheIncrBuiltin(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key    starlark.String
+		amount = starlark.MakeInt(1)
+		ttl    starlark.Int
+	)
+
+	if err := starlark.UnpackArgs(
+		"incr",
+		args, kwargs,
+		"key", &key,
+		"amount?", &amount,
+		"ttl_seconds?", &ttl,
+	); err != nil {
+		return nil, fmt.Errorf("unpacking arguments for cache.incr: %v", err)
+	}
+
+	cacheKey := scopedCacheKey(thread, key)
+
+	delta, ok := amount.Int64()
+	if !ok {
+		return nil, fmt.Errorf("amount must be valid integer (not %s)", amount.String())
+	}
+
+	ttl64, err := ttlSeconds(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache == nil {
+		// no cache configured
+		return starlark.None, nil
+	}
+
+	n, err := cacheIncr(thread, cacheKey, delta, ttl64)
+	recordCacheOperation(thread, CacheOperationRecord{Operation: "incr", Key: key.GoString(), TTL: ttl64})
+	if errors.Is(err, ErrCacheValueNotInteger) {
+		return nil, fmt.Errorf("cache.incr: %s: %w", key.GoString(), err)
+	}
+	if err != nil {
+		log.Printf("incrementing %s in cache: %v", cacheKey, err)
+		return starlark.None, nil
+	}
+
+	return starlark.MakeInt64(n), nil
+}
+
+func cacheGetOrSet(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		key starlark.String
+		fn  starlark.Callable
+		ttl starlark.Int
+	)
+
+	if err := starlark.UnpackArgs(
+		"get_or_set",
+		args, kwargs,
+		"key", &key,
+		"fn", &fn,
+		"ttl_seconds?", &ttl,
+	); err != nil {
+		return nil, fmt.Errorf("unpacking arguments for cache.get_or_set: %v", err)
+	}
+
+	cacheKey := scopedCacheKey(thread, key)
+
+	ttl64, err := ttlSeconds(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		val, found, err := cache.Get(thread, cacheKey)
+		recordCacheOperation(thread, CacheOperationRecord{Operation: "get", Key: key.GoString(), Hit: found && err == nil})
+		if err != nil {
+			// don't fail just because cache is misbehaving
+			log.Printf("getting %s from cache: %v", cacheKey, err)
+		} else if found {
+			return starlark.String(val), nil
+		}
+	}
+
+	result, err := starlark.Call(thread, fn, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	val, ok := result.(starlark.String)
+	if !ok {
+		return nil, fmt.Errorf("cache.get_or_set: fn must return a string (not %s)", result.Type())
+	}
+
+	if cache != nil {
+		if err := cache.Set(thread, cacheKey, []byte(val.GoString()), ttl64); err != nil {
+			log.Printf("setting %s in cache: %v", cacheKey, err)
+		}
+		recordCacheOperation(thread, CacheOperationRecord{Operation: "set", Key: key.GoString(), TTL: ttl64})
+	}
+
+	return val, nil
+}
+
+// ttlSeconds validates a ttl_seconds argument, applying the default
+// expiration if it's zero.
+func ttlSeconds(ttl starlark.Int) (int64, error) {
+	ttl64, ok := ttl.Int64()
+	if !ok {
+		return 0, fmt.Errorf("ttl_seconds must be valid integer (not %s)", ttl.String())
+	}
+
+	if ttl64 < 0 {
+		return 0, fmt.Errorf("ttl_seconds cannot be negative")
+	}
+
+	if ttl64 == 0 {
+		ttl64 = DefaultExpirationSeconds
+	}
+
+	return ttl64, nil
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.starlark.net/starlark"
 )
 
 func TestCacheGetAndSet(t *testing.T) {
@@ -128,3 +129,101 @@ def main():
 	assert.Error(t, err)
 	assert.Nil(t, screens)
 }
+
+func TestCacheDeleteTTLAndIncr(t *testing.T) {
+	src := `
+load("assert.star", "assert")
+load("render.star", "render")
+load("cache.star", "cache")
+
+def main():
+    cache.set("key", "value", ttl_seconds = 30)
+    ttl = cache.ttl("key")
+    assert.true(ttl != None and ttl <= 30)
+
+    cache.delete("key")
+    assert.eq(cache.get("key"), None)
+    assert.eq(cache.ttl("key"), None)
+
+    assert.eq(cache.incr("counter"), 1)
+    assert.eq(cache.incr("counter", 5), 6)
+    assert.eq(cache.incr("counter", amount = -2), 4)
+    assert.eq(cache.get("counter"), "4")
+
+    return render.Root(child=render.Box())
+`
+	for name, c := range map[string]Cache{
+		"in-memory": NewInMemoryCache(),
+		"fallback":  &getSetCache{NewInMemoryCache()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			InitCache(c)
+			app, err := NewApplet("test.star", []byte(src))
+			assert.NoError(t, err)
+
+			_, err = app.Run(context.Background())
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCacheIncrNotInteger(t *testing.T) {
+	src := `
+load("render.star", "render")
+load("cache.star", "cache")
+
+def main():
+    cache.set("key", "value")
+    cache.incr("key")
+    return render.Root(child=render.Box())
+`
+	InitCache(NewInMemoryCache())
+	app, err := NewApplet("test.star", []byte(src))
+	assert.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	assert.ErrorContains(t, err, "not an integer")
+}
+
+func TestCacheGetOrSet(t *testing.T) {
+	src := `
+load("assert.star", "assert")
+load("render.star", "render")
+load("cache.star", "cache")
+
+def main():
+    calls = []
+
+    def fetch():
+        calls.append(1)
+        return "fetched"
+
+    assert.eq(cache.get_or_set("key", fetch, ttl_seconds = 30), "fetched")
+    assert.eq(cache.get_or_set("key", fetch), "fetched")
+    assert.eq(len(calls), 1)
+
+    assert.fails(lambda: cache.get_or_set("other", lambda: 1), "must return a string")
+
+    return render.Root(child=render.Box())
+`
+	InitCache(NewInMemoryCache())
+	app, err := NewApplet("test.star", []byte(src))
+	assert.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	assert.NoError(t, err)
+}
+
+// getSetCache hides everything but Get and Set from the wrapped cache, to
+// exercise the fallbacks for caches that don't support other operations.
+type getSetCache struct {
+	c Cache
+}
+
+func (c *getSetCache) Get(thread *starlark.Thread, key string) ([]byte, bool, error) {
+	return c.c.Get(thread, key)
+}
+
+func (c *getSetCache) Set(thread *starlark.Thread, key string, value []byte, ttl int64) error {
+	return c.c.Set(thread, key, value, ttl)
+}
@@ -0,0 +1,282 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+const cassetteSuffix = ".yaml"
+
+// cassetteInteraction is a single recorded request and its response.
+//
+// A cassette is a directory of interactions, one YAML file per request.
+// Requests are matched using the same hashing as the HTTP cache, so a request
+// is replayed whenever it would have been a cache hit. The files are meant to
+// be edited by hand, for example to craft error responses.
+type cassetteInteraction struct {
+	Request  cassetteRequest  `yaml:"request"`
+	Response cassetteResponse `yaml:"response"`
+}
+
+type cassetteRequest struct {
+	Method     string              `yaml:"method"`
+	URL        string              `yaml:"url"`
+	Headers    map[string][]string `yaml:"headers,omitempty"`
+	Body       string              `yaml:"body,omitempty"`
+	BodyBase64 string              `yaml:"body_base64,omitempty"`
+}
+
+type cassetteResponse struct {
+	Status     int                 `yaml:"status"`
+	Headers    map[string][]string `yaml:"headers,omitempty"`
+	Body       string              `yaml:"body,omitempty"`
+	BodyBase64 string              `yaml:"body_base64,omitempty"`
+}
+
+// CassetteRecorder is an http.RoundTripper that saves every request it sends,
+// along with the response, to a cassette directory.
+type CassetteRecorder struct {
+	dir       string
+	transport http.RoundTripper
+	mutex     sync.Mutex
+}
+
+// NewCassetteRecorder creates a recorder that sends requests through
+// transport and saves them to dir, creating the directory if needed.
+func NewCassetteRecorder(dir string, transport http.RoundTripper) (*CassetteRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating cassette directory: %w", err)
+	}
+
+	return &CassetteRecorder{
+		dir:       dir,
+		transport: transport,
+	}, nil
+}
+
+func (r *CassetteRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := cacheKey(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate cassette key: %w", err)
+	}
+
+	// cacheKey has consumed and replaced the request body, so read it again
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseBytes))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := cassetteInteraction{
+		Request: cassetteRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: cassetteHeaders(req.Header),
+		},
+		Response: cassetteResponse{
+			Status:  resp.StatusCode,
+			Headers: cassetteHeaders(resp.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.BodyBase64 = encodeCassetteBody(reqBody)
+	interaction.Response.Body, interaction.Response.BodyBase64 = encodeCassetteBody(respBody)
+
+	b, err := yaml.Marshal(interaction)
+	if err != nil {
+		return nil, fmt.Errorf("serializing interaction: %w", err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := os.WriteFile(filepath.Join(r.dir, cassetteFileName(key)), b, 0644); err != nil {
+		return nil, fmt.Errorf("writing interaction: %w", err)
+	}
+
+	return resp, nil
+}
+
+// CassetteReplayer is an http.RoundTripper that serves responses from a
+// cassette directory instead of the network. Requests that weren't recorded
+// fail with an error.
+type CassetteReplayer struct {
+	dir          string
+	interactions map[string]*cassetteInteraction
+}
+
+// NewCassetteReplayer loads all interactions recorded in dir.
+func NewCassetteReplayer(dir string) (*CassetteReplayer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+cassetteSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("listing cassette: %w", err)
+	}
+
+	if len(paths) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("opening cassette: %w", err)
+		}
+	}
+
+	r := &CassetteReplayer{
+		dir:          dir,
+		interactions: make(map[string]*cassetteInteraction, len(paths)),
+	}
+
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p, err)
+		}
+
+		interaction := &cassetteInteraction{}
+		if err := yaml.Unmarshal(b, interaction); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", p, err)
+		}
+
+		req, err := interaction.Request.httpRequest()
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", p, err)
+		}
+
+		key, err := cacheKey(req)
+		if err != nil {
+			return nil, fmt.Errorf("hashing request in %s: %w", p, err)
+		}
+
+		r.interactions[key] = interaction
+	}
+
+	return r, nil
+}
+
+func (r *CassetteReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := cacheKey(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate cassette key: %w", err)
+	}
+
+	interaction, ok := r.interactions[key]
+	if !ok {
+		return nil, fmt.Errorf(
+			"no recorded response for %s %s in %s (expected %s)",
+			req.Method, req.URL, r.dir, cassetteFileName(key),
+		)
+	}
+
+	body, err := decodeCassetteBody(interaction.Response.Body, interaction.Response.BodyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding recorded response body: %w", err)
+	}
+
+	header := http.Header{}
+	for k, vals := range interaction.Response.Headers {
+		for _, v := range vals {
+			header.Add(k, v)
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode:    interaction.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (cr *cassetteRequest) httpRequest() (*http.Request, error) {
+	body, err := decodeCassetteBody(cr.Body, cr.BodyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding request body: %w", err)
+	}
+
+	var reqBody io.Reader
+	if len(body) > 0 {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(cr.Method, cr.URL, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, vals := range cr.Headers {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+
+	return req, nil
+}
+
+// cassetteHeaders copies headers for recording, leaving out the TTL header
+// since it's not part of the cache key either.
+func cassetteHeaders(h http.Header) map[string][]string {
+	headers := make(map[string][]string, len(h))
+	for k, vals := range h {
+		if http.CanonicalHeaderKey(k) == TTLHeader {
+			continue
+		}
+		headers[k] = vals
+	}
+
+	if len(headers) == 0 {
+		return nil
+	}
+
+	return headers
+}
+
+func encodeCassetteBody(b []byte) (text string, b64 string) {
+	if utf8.Valid(b) {
+		return string(b), ""
+	}
+
+	return "", base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeCassetteBody(text, b64 string) ([]byte, error) {
+	if b64 != "" {
+		return base64.StdEncoding.DecodeString(b64)
+	}
+
+	return []byte(text), nil
+}
+
+func cassetteFileName(key string) string {
+	hash := key[strings.LastIndex(key, ":")+1:]
+	if len(hash) > 16 {
+		hash = hash[:16]
+	}
+
+	return hash + cassetteSuffix
+}
@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"method": "%s", "path": "%s"}`, r.Method, r.URL.Path)
+	}))
+
+	src := fmt.Sprintf(`
+load("assert.star", "assert")
+load("http.star", "http")
+load("render.star", "render")
+
+def main():
+    resp = http.get("%[1]s/get")
+    assert.eq(resp.json()["path"], "/get")
+
+    resp = http.post("%[1]s/post", json_body = {"foo": "bar"})
+    assert.eq(resp.json()["method"], "POST")
+
+    return render.Root(child=render.Box())
+`, ts.URL)
+
+	dir := t.TempDir()
+
+	recorder, err := NewCassetteRecorder(dir, http.DefaultTransport)
+	require.NoError(t, err)
+	InitHTTP(NewInMemoryCache(), WithHTTPTransport(recorder))
+
+	app, err := NewApplet("test", []byte(src))
+	require.NoError(t, err)
+	_, err = app.Run(context.Background())
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// replay without the server
+	ts.Close()
+
+	replayer, err := NewCassetteReplayer(dir)
+	require.NoError(t, err)
+	InitHTTP(NewInMemoryCache(), WithHTTPTransport(replayer))
+
+	_, err = app.Run(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestCassetteReplayUnrecorded(t *testing.T) {
+	src := `
+load("http.star", "http")
+load("render.star", "render")
+
+def main():
+    http.get("https://example.com/unrecorded")
+    return render.Root(child=render.Box())
+`
+	replayer, err := NewCassetteReplayer(t.TempDir())
+	require.NoError(t, err)
+	InitHTTP(NewInMemoryCache(), WithHTTPTransport(replayer))
+
+	app, err := NewApplet("test", []byte(src))
+	require.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	assert.ErrorContains(t, err, "no recorded response for GET https://example.com/unrecorded")
+}
+
+func TestCassetteHandCrafted(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "ratelimited.yaml"), []byte(`
+request:
+  method: GET
+  url: https://example.com/api
+  headers:
+    X-Tidbyt-App: [test]
+response:
+  status: 429
+  headers:
+    Retry-After: ["60"]
+  body: |
+    {"error": "slow down"
+`), 0644)
+	require.NoError(t, err)
+
+	src := `
+load("assert.star", "assert")
+load("http.star", "http")
+load("render.star", "render")
+
+def main():
+    resp = http.get("https://example.com/api")
+    assert.eq(resp.status_code, 429)
+    assert.eq(resp.headers["Retry-After"], "60")
+    assert.fails(resp.json, "unexpected end of JSON input")
+    return render.Root(child=render.Box())
+`
+	replayer, err := NewCassetteReplayer(dir)
+	require.NoError(t, err)
+	InitHTTP(NewInMemoryCache(), WithHTTPTransport(replayer))
+
+	app, err := NewApplet("test", []byte(src))
+	require.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestCassetteReplayMissingDir(t *testing.T) {
+	_, err := NewCassetteReplayer(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -1,11 +1,18 @@
 package runtime
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/hashstructure/v2"
+	starlibjson "go.starlark.net/lib/json"
+	starlibtime "go.starlark.net/lib/time"
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
 )
 
 type AppletConfig map[string]string
@@ -15,6 +22,12 @@ func (a AppletConfig) AttrNames() []string {
 		"get",
 		"str",
 		"bool",
+		"int",
+		"float",
+		"json",
+		"color",
+		"location",
+		"datetime",
 	}
 }
 
@@ -27,6 +40,24 @@ func (a AppletConfig) Attr(name string) (starlark.Value, error) {
 	case "bool":
 		return starlark.NewBuiltin("bool", a.getBoolean), nil
 
+	case "int":
+		return a.typedGetter("int", parseConfigInt), nil
+
+	case "float":
+		return a.typedGetter("float", parseConfigFloat), nil
+
+	case "json":
+		return a.typedGetter("json", parseConfigJSON), nil
+
+	case "color":
+		return a.typedGetter("color", parseConfigColor), nil
+
+	case "location":
+		return a.typedGetter("location", parseConfigLocation), nil
+
+	case "datetime":
+		return a.typedGetter("datetime", parseConfigDatetime), nil
+
 	default:
 		return nil, nil
 	}
@@ -92,3 +123,130 @@ func (a AppletConfig) getBoolean(thread *starlark.Thread, _ *starlark.Builtin, a
 		return starlark.Bool(b), nil
 	}
 }
+
+// configParser converts a config value into a Starlark value.
+type configParser func(thread *starlark.Thread, val string) (starlark.Value, error)
+
+// typedGetter returns a builtin that looks up a config value and converts it
+// with parse. If the value is missing or empty, the default is returned. If
+// it's malformed, a warning is logged and the default is returned, so that a
+// bad value doesn't take the app down.
+func (a AppletConfig) typedGetter(name string, parse configParser) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var key starlark.String
+		var def starlark.Value
+		def = starlark.None
+
+		if err := starlark.UnpackPositionalArgs(
+			name, args, kwargs, 1,
+			&key, &def,
+		); err != nil {
+			return nil, fmt.Errorf("unpacking arguments for config.%s: %v", name, err)
+		}
+
+		val, ok := a[key.GoString()]
+		if !ok || val == "" {
+			return def, nil
+		}
+
+		v, err := parse(thread, val)
+		if err != nil {
+			log.Printf("config.%s: malformed value for %s, using default: %v", name, key.GoString(), err)
+			return def, nil
+		}
+
+		return v, nil
+	})
+}
+
+func parseConfigInt(_ *starlark.Thread, val string) (starlark.Value, error) {
+	i, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.MakeInt64(i), nil
+}
+
+func parseConfigFloat(_ *starlark.Thread, val string) (starlark.Value, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Float(f), nil
+}
+
+func parseConfigJSON(thread *starlark.Thread, val string) (starlark.Value, error) {
+	return starlark.Call(thread, starlibjson.Module.Members["decode"], starlark.Tuple{starlark.String(val)}, nil)
+}
+
+// parseConfigColor accepts colors in the same hex formats as render.star,
+// and normalizes them to lowercase with a leading #.
+func parseConfigColor(_ *starlark.Thread, val string) (starlark.Value, error) {
+	hex := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(val)), "#")
+
+	switch len(hex) {
+	case 3, 4, 6, 8:
+	default:
+		return nil, fmt.Errorf("expected 3, 4, 6 or 8 hex chars but found %d", len(hex))
+	}
+
+	if _, err := strconv.ParseUint(hex, 16, 64); err != nil {
+		return nil, fmt.Errorf("expected hex chars a-f,0-9 but found %s", hex)
+	}
+
+	return starlark.String("#" + hex), nil
+}
+
+// configLocation is the JSON encoding of values set by schema.Location.
+// Coordinates are usually strings, but numbers are accepted too.
+type configLocation struct {
+	Lat         json.Number `json:"lat"`
+	Lng         json.Number `json:"lng"`
+	Timezone    string      `json:"timezone"`
+	Description string      `json:"description"`
+	Locality    string      `json:"locality"`
+	PlaceID     string      `json:"place_id"`
+}
+
+func parseConfigLocation(_ *starlark.Thread, val string) (starlark.Value, error) {
+	var loc configLocation
+	if err := json.Unmarshal([]byte(val), &loc); err != nil {
+		return nil, err
+	}
+
+	lat, err := loc.Lat.Float64()
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("invalid latitude: %q", loc.Lat)
+	}
+
+	lng, err := loc.Lng.Float64()
+	if err != nil || lng < -180 || lng > 180 {
+		return nil, fmt.Errorf("invalid longitude: %q", loc.Lng)
+	}
+
+	if loc.Timezone != "" {
+		if _, err := time.LoadLocation(loc.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"lat":         starlark.Float(lat),
+		"lng":         starlark.Float(lng),
+		"timezone":    starlark.String(loc.Timezone),
+		"description": starlark.String(loc.Description),
+		"locality":    starlark.String(loc.Locality),
+		"place_id":    starlark.String(loc.PlaceID),
+	}), nil
+}
+
+func parseConfigDatetime(_ *starlark.Thread, val string) (starlark.Value, error) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(val))
+	if err != nil {
+		return nil, err
+	}
+
+	return starlibtime.Time(t), nil
+}
@@ -0,0 +1,157 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tidbyt.dev/pixlet/schema"
+)
+
+// ConfigViolation describes a config value that doesn't match the applet's
+// schema.
+type ConfigViolation struct {
+	Field   string `json:"field"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v ConfigViolation) String() string {
+	if v.Value == "" {
+		return fmt.Sprintf("%s: %s", v.Field, v.Message)
+	}
+	return fmt.Sprintf("%s: %s (got %q)", v.Field, v.Message, v.Value)
+}
+
+// ConfigValidationError is returned when running an applet with config that
+// fails validation.
+type ConfigValidationError struct {
+	Violations []ConfigViolation
+}
+
+func (e *ConfigValidationError) Error() string {
+	lines := make([]string, 0, len(e.Violations)+1)
+	lines = append(lines, "invalid config:")
+	for _, v := range e.Violations {
+		lines = append(lines, "- "+v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WithConfigValidation makes the applet validate config against its schema
+// before running main(), using ValidateConfig. Runs with invalid config fail
+// with a ConfigValidationError, and missing values are filled in with the
+// defaults from the schema.
+func WithConfigValidation() AppletOption {
+	return func(a *Applet) error {
+		a.validateConfig = true
+		return nil
+	}
+}
+
+// ValidateConfig checks config against the applet's schema. It returns a copy
+// of config where missing or empty values are set to the field's default,
+// along with any violations found:
+//
+//   - dropdown and radio values must be one of the field's options
+//   - toggle values must be booleans
+//   - color, datetime and location values must be well-formed
+//   - keys must belong to a field, unless the schema has generated fields,
+//     whose keys can't be known in advance
+//
+// If the applet has no schema, config is returned as is.
+func (a *Applet) ValidateConfig(config map[string]string) (map[string]string, []ConfigViolation) {
+	if a.Schema == nil {
+		return config, nil
+	}
+
+	filled := make(map[string]string, len(config))
+	for k, v := range config {
+		filled[k] = v
+	}
+
+	var violations []ConfigViolation
+	known := map[string]bool{}
+	generated := false
+
+	for _, field := range a.Schema.Fields {
+		known[field.ID] = true
+		if field.Type == "generated" {
+			generated = true
+		}
+
+		val := filled[field.ID]
+		if val == "" {
+			if field.Default != "" {
+				filled[field.ID] = field.Default
+			}
+			continue
+		}
+
+		if msg := validateConfigValue(field.Type, field.Options, val); msg != "" {
+			violations = append(violations, ConfigViolation{
+				Field:   field.ID,
+				Value:   val,
+				Message: msg,
+			})
+		}
+	}
+
+	if !generated {
+		var unknown []string
+		for k := range config {
+			if !known[k] {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+
+		for _, k := range unknown {
+			violations = append(violations, ConfigViolation{
+				Field:   k,
+				Message: "not a field in the schema",
+			})
+		}
+	}
+
+	return filled, violations
+}
+
+// validateConfigValue returns a description of what's wrong with a value for
+// a field of the given type, or an empty string if it's valid.
+func validateConfigValue(fieldType string, options []schema.SchemaOption, val string) string {
+	switch fieldType {
+	case "dropdown", "radio":
+		values := make([]string, 0, len(options))
+		for _, opt := range options {
+			if opt.Value == val {
+				return ""
+			}
+			values = append(values, strconv.Quote(opt.Value))
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(values, ", "))
+
+	case "onoff":
+		if _, err := strconv.ParseBool(val); err != nil {
+			return "must be true or false"
+		}
+
+	case "color":
+		if _, err := parseConfigColor(nil, val); err != nil {
+			return fmt.Sprintf("invalid color: %v", err)
+		}
+
+	case "datetime":
+		if _, err := parseConfigDatetime(nil, val); err != nil {
+			return "must be an RFC 3339 timestamp"
+		}
+
+	case "location":
+		if _, err := parseConfigLocation(nil, val); err != nil {
+			return fmt.Sprintf("invalid location: %v", err)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,125 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tidbyt.dev/pixlet/render"
+)
+
+var configValidationSrc = `
+load("render.star", "render")
+load("schema.star", "schema")
+
+def main(config):
+    return render.Root(child=render.Text(config.str("units") + " " + str(config.bool("party_mode"))))
+
+def get_schema():
+    return schema.Schema(
+        version = "1",
+        fields = [
+            schema.Dropdown(
+                id = "units",
+                name = "Units",
+                desc = "Units to display.",
+                icon = "ruler",
+                default = "metric",
+                options = [
+                    schema.Option(display = "Metric", value = "metric"),
+                    schema.Option(display = "Imperial", value = "imperial"),
+                ],
+            ),
+            schema.Toggle(
+                id = "party_mode",
+                name = "Party Mode",
+                desc = "A toggle to enable party mode.",
+                icon = "gear",
+                default = True,
+            ),
+            schema.Color(
+                id = "color",
+                name = "Color",
+                desc = "Text color.",
+                icon = "brush",
+                default = "#fff",
+            ),
+            schema.Text(
+                id = "who",
+                name = "Who",
+                desc = "Who to greet.",
+                icon = "user",
+            ),
+        ],
+    )
+`
+
+func TestValidateConfig(t *testing.T) {
+	app, err := NewApplet("test.star", []byte(configValidationSrc))
+	require.NoError(t, err)
+
+	filled, violations := app.ValidateConfig(map[string]string{"who": "world"})
+	assert.Empty(t, violations)
+	assert.Equal(t, map[string]string{
+		"units":      "metric",
+		"party_mode": "true",
+		"color":      "#fff",
+		"who":        "world",
+	}, filled)
+
+	_, violations = app.ValidateConfig(map[string]string{
+		"units":      "kelvin",
+		"party_mode": "yes",
+		"color":      "white",
+		"who":        "anything goes",
+		"unts":       "metric",
+	})
+	assert.Equal(t, []ConfigViolation{
+		{Field: "units", Value: "kelvin", Message: `must be one of "metric", "imperial"`},
+		{Field: "party_mode", Value: "yes", Message: "must be true or false"},
+		{Field: "color", Value: "white", Message: "invalid color: expected 3, 4, 6 or 8 hex chars but found 5"},
+		{Field: "unts", Message: "not a field in the schema"},
+	}, violations)
+}
+
+func TestValidateConfigWithoutSchema(t *testing.T) {
+	src := `
+load("render.star", "render")
+def main():
+    return render.Root(child=render.Box())
+`
+	app, err := NewApplet("test.star", []byte(src))
+	require.NoError(t, err)
+
+	config := map[string]string{"anything": "goes"}
+	filled, violations := app.ValidateConfig(config)
+	assert.Empty(t, violations)
+	assert.Equal(t, config, filled)
+}
+
+func TestRunWithConfigValidation(t *testing.T) {
+	app, err := NewApplet("test.star", []byte(configValidationSrc), WithConfigValidation())
+	require.NoError(t, err)
+
+	config := map[string]string{"units": "imperial"}
+	roots, err := app.RunWithConfig(context.Background(), config)
+	require.NoError(t, err)
+	assert.Equal(t, "imperial True", roots[0].Child.(*render.Text).Content)
+
+	// the caller's config is left untouched
+	assert.Equal(t, map[string]string{"units": "imperial"}, config)
+
+	_, err = app.RunWithConfig(context.Background(), map[string]string{"units": "kelvin"})
+	var validationErr *ConfigValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Violations, 1)
+	assert.ErrorContains(t, err, "units: must be one of")
+
+	// without the option, anything goes
+	app, err = NewApplet("test.star", []byte(configValidationSrc))
+	require.NoError(t, err)
+	_, err = app.RunWithConfig(context.Background(), map[string]string{"units": "kelvin"})
+	assert.NoError(t, err)
+}
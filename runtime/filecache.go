@@ -0,0 +1,364 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	// DefaultFileCacheMaxBytes is the default maximum size of a FileCache.
+	DefaultFileCacheMaxBytes = 256 * 1024 * 1024 // 256MB
+
+	fileCacheSuffix     = ".cache"
+	fileCacheHeaderSize = 8
+
+	// fileCacheTempPrefix starts the names of records being written. Those
+	// left behind by a crash are removed when evicting, once they're older
+	// than fileCacheTempMaxAge.
+	fileCacheTempPrefix = ".tmp-"
+	fileCacheTempMaxAge = 1 * time.Hour
+
+	// fileCacheLowWaterPercent is the percentage of maxBytes that eviction
+	// trims the cache down to, so that a full cache isn't rescanned on every
+	// write.
+	fileCacheLowWaterPercent = 90
+
+	// fileCacheIncrLock is the lock file that serializes increments between
+	// processes. A single lock for the whole directory, rather than one per
+	// key, means that lock files don't pile up next to the records.
+	fileCacheIncrLock = ".incr.lock"
+)
+
+// FileCache is a Cache that stores records on disk, so that they survive
+// restarts. Each record is stored in its own file, named after a hash of the
+// key. Files are written atomically, and increments are serialized with a
+// file lock, so a cache directory can safely be shared between several
+// processes.
+//
+// When the total size of the cache exceeds maxBytes, the least recently used
+// records are evicted until it's back under 90% of maxBytes. Recency is
+// tracked using file modification times.
+type FileCache struct {
+	dir      string
+	maxBytes int64
+
+	mutex sync.Mutex
+	size  int64
+
+	// incrMutex serializes increments within this process, and the file lock
+	// that it guards serializes them with other processes.
+	incrMutex sync.Mutex
+}
+
+// NewFileCache creates a FileCache that stores records in dir, creating the
+// directory if needed. If maxBytes is zero or negative,
+// DefaultFileCacheMaxBytes is used.
+func NewFileCache(dir string, maxBytes int64) (*FileCache, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultFileCacheMaxBytes
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	c := &FileCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+
+	if err := c.evict(); err != nil {
+		return nil, fmt.Errorf("scanning cache directory: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *FileCache) Get(_ *starlark.Thread, key string) (value []byte, found bool, err error) {
+	value, _, found, err = c.read(key)
+	return value, found, err
+}
+
+func (c *FileCache) Set(_ *starlark.Thread, key string, value []byte, ttl int64) error {
+	return c.write(key, value, time.Now().Add(time.Duration(ttl)*time.Second))
+}
+
+func (c *FileCache) Delete(_ *starlark.Thread, key string) error {
+	if err := c.remove(c.path(key), nil); err != nil {
+		return fmt.Errorf("deleting cache record: %w", err)
+	}
+
+	return nil
+}
+
+func (c *FileCache) TTL(_ *starlark.Thread, key string) (int64, bool, error) {
+	_, expiration, found, err := c.read(key)
+	if err != nil || !found {
+		return 0, false, err
+	}
+
+	return ceilSeconds(time.Until(expiration)), true, nil
+}
+
+func (c *FileCache) Incr(_ *starlark.Thread, key string, delta int64, ttl int64) (int64, error) {
+	c.incrMutex.Lock()
+	defer c.incrMutex.Unlock()
+
+	unlock, err := lockFile(filepath.Join(c.dir, fileCacheIncrLock))
+	if err != nil {
+		return 0, fmt.Errorf("locking cache: %w", err)
+	}
+	defer unlock()
+
+	value, expiration, found, err := c.read(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if !found {
+		expiration = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+
+	n, err := incrValue(value, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.write(key, []byte(strconv.FormatInt(n, 10)), expiration); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (c *FileCache) read(key string) (value []byte, expiration time.Time, found bool, err error) {
+	p := c.path(key)
+
+	b, info, err := readFileInfo(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("reading cache record: %w", err)
+	}
+
+	if len(b) < fileCacheHeaderSize {
+		// truncated or corrupt record, treat it as missing
+		c.remove(p, info)
+		return nil, time.Time{}, false, nil
+	}
+
+	expiration = time.Unix(0, int64(binary.BigEndian.Uint64(b[:fileCacheHeaderSize])))
+	if time.Now().After(expiration) {
+		c.remove(p, info)
+		return nil, time.Time{}, false, nil
+	}
+
+	// bump the modification time so that this record is considered recently
+	// used when evicting
+	now := time.Now()
+	os.Chtimes(p, now, now)
+
+	return b[fileCacheHeaderSize:], expiration, true, nil
+}
+
+func (c *FileCache) write(key string, value []byte, expiration time.Time) error {
+	b := make([]byte, fileCacheHeaderSize+len(value))
+	binary.BigEndian.PutUint64(b, uint64(expiration.UnixNano()))
+	copy(b[fileCacheHeaderSize:], value)
+
+	// write to a temporary file and rename it into place, so that concurrent
+	// readers never observe a partially written record
+	f, err := os.CreateTemp(c.dir, fileCacheTempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("creating cache record: %w", err)
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("writing cache record: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing cache record: %w", err)
+	}
+
+	// the record being replaced, if any, no longer counts towards the size
+	p := c.path(key)
+	var replaced int64
+	if info, err := os.Stat(p); err == nil {
+		replaced = info.Size()
+	}
+
+	if err := os.Rename(f.Name(), p); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("storing cache record: %w", err)
+	}
+
+	c.mutex.Lock()
+	c.size += int64(len(b)) - replaced
+	overLimit := c.size > c.maxBytes
+	c.mutex.Unlock()
+
+	if overLimit {
+		return c.evict()
+	}
+
+	return nil
+}
+
+// remove removes the record stored at p, if there is one, and takes it out of
+// the size of the cache. If read is set, the record is only removed if it's
+// still the file that read describes, so that a record that another process
+// stored in the meantime is kept.
+func (c *FileCache) remove(p string, read fs.FileInfo) error {
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if read != nil && !sameRecord(read, info) {
+		return nil
+	}
+
+	if err := os.Remove(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed by another process in the meantime
+			return nil
+		}
+		return err
+	}
+
+	c.mutex.Lock()
+	c.size -= info.Size()
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// readFileInfo reads the file at p, and returns it along with its info.
+func readFileInfo(p string) ([]byte, fs.FileInfo, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return b, info, nil
+}
+
+// sameRecord reports whether a and b describe the same version of a record.
+// Records are replaced by renaming a new file over them, so a record stored
+// since a was taken is a different file.
+func sameRecord(a, b fs.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+func (c *FileCache) path(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(h[:])+fileCacheSuffix)
+}
+
+// evict scans the cache directory and, if the cache doesn't fit in maxBytes,
+// removes the least recently used records until it's down to the low-water
+// mark. Expired records are removed lazily by Get. Temporary files left
+// behind by crashes are removed too.
+func (c *FileCache) evict() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type record struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var (
+		records []record
+		size    int64
+	)
+
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), fileCacheTempPrefix) {
+			// left behind by a process that crashed while writing, unless
+			// it's recent enough to still be in progress
+			if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > fileCacheTempMaxAge {
+				os.Remove(filepath.Join(c.dir, e.Name()))
+			}
+			continue
+		}
+
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileCacheSuffix) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			// removed by another process in the meantime
+			continue
+		}
+
+		records = append(records, record{
+			path:    filepath.Join(c.dir, e.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		size += info.Size()
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].modTime.Before(records[j].modTime)
+	})
+
+	target := c.maxBytes
+	if size > c.maxBytes {
+		target = c.maxBytes * fileCacheLowWaterPercent / 100
+	}
+
+	for _, r := range records {
+		if size <= target {
+			break
+		}
+
+		if err := os.Remove(r.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+			size -= r.size
+		}
+	}
+
+	c.size = size
+	return nil
+}
@@ -0,0 +1,246 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCacheGetAndSet(t *testing.T) {
+	c, err := NewFileCache(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	_, found, err := c.Get(nil, "foo")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), 60))
+
+	val, found, err := c.Get(nil, "foo")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("bar"), val)
+}
+
+func TestFileCacheSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := NewFileCache(dir, 0)
+	require.NoError(t, err)
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), 60))
+
+	c, err = NewFileCache(dir, 0)
+	require.NoError(t, err)
+
+	val, found, err := c.Get(nil, "foo")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("bar"), val)
+}
+
+func TestFileCacheExpiration(t *testing.T) {
+	c, err := NewFileCache(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), -1))
+
+	_, found, err := c.Get(nil, "foo")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestFileCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+
+	// room for two records of 100 bytes, including headers, but not three
+	c, err := NewFileCache(dir, 3*(100+fileCacheHeaderSize)-1)
+	require.NoError(t, err)
+
+	value := []byte(strings.Repeat("x", 100))
+	assert.NoError(t, c.Set(nil, "one", value, 60))
+	assert.NoError(t, c.Set(nil, "two", value, 60))
+
+	// make "one" the least recently used record
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(c.path("one"), old, old))
+
+	assert.NoError(t, c.Set(nil, "three", value, 60))
+
+	_, found, _ := c.Get(nil, "one")
+	assert.False(t, found)
+	_, found, _ = c.Get(nil, "two")
+	assert.True(t, found)
+	_, found, _ = c.Get(nil, "three")
+	assert.True(t, found)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.Equal(t, fileCacheSuffix, filepath.Ext(e.Name()))
+	}
+}
+
+func TestFileCacheEvictsToLowWaterMark(t *testing.T) {
+	dir := t.TempDir()
+
+	// room for ten records of 100 bytes, including headers
+	c, err := NewFileCache(dir, 10*(100+fileCacheHeaderSize))
+	require.NoError(t, err)
+
+	value := []byte(strings.Repeat("x", 100))
+	old := time.Now().Add(-time.Hour)
+	for i := 0; i < 11; i++ {
+		key := fmt.Sprintf("key%d", i)
+		assert.NoError(t, c.Set(nil, key, value, 60))
+		used := old.Add(time.Duration(i) * time.Second)
+		require.NoError(t, os.Chtimes(c.path(key), used, used))
+	}
+
+	// going over maxBytes evicts down to 90% of it, leaving room for the
+	// next write
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 9)
+	assert.Equal(t, int64(9*(100+fileCacheHeaderSize)), c.size)
+
+	_, found, _ := c.Get(nil, "key1")
+	assert.False(t, found)
+	_, found, _ = c.Get(nil, "key2")
+	assert.True(t, found)
+}
+
+func TestFileCacheSize(t *testing.T) {
+	c, err := NewFileCache(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	value := []byte(strings.Repeat("x", 100))
+	size := int64(100 + fileCacheHeaderSize)
+
+	// overwriting a record replaces its size
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Set(nil, "foo", value, 60))
+		assert.Equal(t, size, c.size)
+	}
+
+	assert.NoError(t, c.Set(nil, "bar", value, 60))
+	assert.Equal(t, 2*size, c.size)
+
+	assert.NoError(t, c.Delete(nil, "foo"))
+	assert.NoError(t, c.Delete(nil, "foo"))
+	assert.Equal(t, size, c.size)
+
+	// expired records are removed when read
+	assert.NoError(t, c.Set(nil, "bar", value, -1))
+	_, found, _ := c.Get(nil, "bar")
+	assert.False(t, found)
+	assert.Equal(t, int64(0), c.size)
+}
+
+func TestFileCacheKeepsReplacedRecords(t *testing.T) {
+	c, err := NewFileCache(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, c.Set(nil, "foo", []byte("old"), -1))
+	_, read, err := readFileInfo(c.path("foo"))
+	require.NoError(t, err)
+
+	// another process stores a fresh record after the expired one was read,
+	// which mustn't be removed in its place
+	time.Sleep(10 * time.Millisecond)
+	other, err := NewFileCache(c.dir, 0)
+	require.NoError(t, err)
+	assert.NoError(t, other.Set(nil, "foo", []byte("new"), 60))
+
+	assert.NoError(t, c.remove(c.path("foo"), read))
+	b, found, err := c.Get(nil, "foo")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "new", string(b))
+}
+
+func TestFileCacheRemovesOrphanedTempFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	orphan := filepath.Join(dir, fileCacheTempPrefix+"orphan")
+	inProgress := filepath.Join(dir, fileCacheTempPrefix+"in-progress")
+	require.NoError(t, os.WriteFile(orphan, []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(inProgress, []byte("x"), 0644))
+
+	old := time.Now().Add(-2 * fileCacheTempMaxAge)
+	require.NoError(t, os.Chtimes(orphan, old, old))
+
+	_, err := NewFileCache(dir, 0)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, orphan)
+	assert.FileExists(t, inProgress)
+}
+
+func TestFileCacheWithApplet(t *testing.T) {
+	src := `
+load("render.star", "render")
+load("cache.star", "cache")
+
+def main():
+    i = int(cache.get("counter") or '1')
+    cache.set("counter", str(i + 1))
+    return [render.Root(child=render.Box()) for _ in range(i)]
+`
+	dir := t.TempDir()
+
+	for i := 1; i <= 3; i++ {
+		c, err := NewFileCache(dir, 0)
+		require.NoError(t, err)
+		InitCache(c)
+
+		app, err := NewApplet("test.star", []byte(src))
+		require.NoError(t, err)
+
+		roots, err := app.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, i, len(roots))
+	}
+}
+
+func TestFileCacheDeleteTTLAndIncr(t *testing.T) {
+	c, err := NewFileCache(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), 60))
+
+	ttl, found, err := c.TTL(nil, "foo")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(60), ttl)
+
+	assert.NoError(t, c.Delete(nil, "foo"))
+	assert.NoError(t, c.Delete(nil, "foo"))
+	_, found, _ = c.Get(nil, "foo")
+	assert.False(t, found)
+
+	n, err := c.Incr(nil, "counter", 2, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = c.Incr(nil, "counter", 3, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	// the TTL is set when the counter is created
+	ttl, _, _ = c.TTL(nil, "counter")
+	assert.Equal(t, int64(30), ttl)
+
+	_, err = c.Incr(nil, "bar", 1, 60)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Set(nil, "bar", []byte("baz"), 60))
+	_, err = c.Incr(nil, "bar", 1, 60)
+	assert.ErrorIs(t, err, ErrCacheValueNotInteger)
+}
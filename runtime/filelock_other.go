@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package runtime
+
+// lockFile does nothing on platforms without file locks, such as WebAssembly,
+// where there's only ever a single process using the cache.
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
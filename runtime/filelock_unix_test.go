@@ -0,0 +1,66 @@
+//go:build unix
+
+package runtime
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	unlock, err := lockFile(path)
+	require.NoError(t, err)
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := lockFile(path)
+		assert.NoError(t, err)
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("lock was taken twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	<-locked
+}
+
+func TestFileCacheIncrSharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	// each cache has its own mutex, like caches in different processes
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		c, err := NewFileCache(dir, 0)
+		require.NoError(t, err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_, err := c.Incr(nil, "counter", 1, 60)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	c, err := NewFileCache(dir, 0)
+	require.NoError(t, err)
+	b, found, err := c.Get(nil, "counter")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, fmt.Sprint(100), string(b))
+}
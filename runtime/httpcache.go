@@ -12,9 +12,11 @@ import (
 	"net/http/httputil"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 const (
@@ -24,6 +26,25 @@ const (
 	MaxResponseBytes = 20 * 1024 * 1024 // 20MB
 	HTTPCachePrefix  = "httpcache"
 	TTLHeader        = "X-Tidbyt-Cache-Seconds"
+
+	// CacheStatusHeader is set on responses by the HTTP cache, to HIT,
+	// MISS, REVALIDATED for expired responses that the server confirmed
+	// are still current, or STALE for expired responses that were served
+	// because the server failed, or while they're revalidated.
+	CacheStatusHeader = "tidbyt-cache-status"
+
+	// DefaultStaleGrace is how long expired responses without a
+	// stale-if-error directive are served for by default, if the server
+	// fails. It's 0, so that only responses that allow it are served stale.
+	DefaultStaleGrace = 0
+
+	// MaxStaleAge is the longest that expired responses are served for
+	// because of their stale-if-error or stale-while-revalidate directives.
+	MaxStaleAge = 1 * time.Hour
+
+	// cacheExpiresHeader holds the Unix time at which a cached response
+	// expires, while it's in the cache.
+	cacheExpiresHeader = "X-Tidbyt-Cache-Expires"
 )
 
 // Status codes that are cacheable as defined here:
@@ -47,18 +68,89 @@ var cacheableStatusCodes = map[int]bool{
 type cacheClient struct {
 	cache     Cache
 	transport http.RoundTripper
+	guard     *starlarkhttp.NetworkGuard
+	clock     func() time.Time
+
+	// staleGrace is how long expired responses without a stale-if-error
+	// directive are served for, if the server fails.
+	staleGrace time.Duration
+
+	// background is the context that responses are revalidated under in
+	// the background, and revalidations tracks those in progress.
+	background    context.Context
+	revalidations *sync.WaitGroup
+
+	mutex        sync.Mutex
+	revalidating map[string]bool
+}
+
+// HTTPOption configures the HTTP client set up by InitHTTP.
+type HTTPOption func(*cacheClient)
+
+// WithHTTPTransport makes the HTTP client send requests that aren't served
+// from cache through transport, instead of the default transport.
+func WithHTTPTransport(transport http.RoundTripper) HTTPOption {
+	return func(c *cacheClient) {
+		c.transport = transport
+	}
+}
+
+// WithNetworkGuard applies guard to every request made by apps, including
+// redirects. Unless another transport is configured, requests are sent through
+// the guard's transport so that connections are checked too. Otherwise, the
+// configured transport should be built on top of guard.Transport().
+func WithNetworkGuard(guard *starlarkhttp.NetworkGuard) HTTPOption {
+	return func(c *cacheClient) {
+		c.guard = guard
+	}
+}
+
+// WithStaleGrace sets how long expired responses without a stale-if-error
+// directive are kept, to serve if the server fails. By default, it's
+// DefaultStaleGrace, so that errors aren't hidden unless the server allows
+// it.
+func WithStaleGrace(grace time.Duration) HTTPOption {
+	return func(c *cacheClient) {
+		c.staleGrace = grace
+	}
+}
+
+// WithBackgroundRevalidation makes the stale responses that are revalidated
+// in the background, while they're served, be revalidated under ctx, so that
+// cancelling it aborts them, and adds them to wg, so that callers can wait
+// for them to finish, e.g. before exiting.
+func WithBackgroundRevalidation(ctx context.Context, wg *sync.WaitGroup) HTTPOption {
+	return func(c *cacheClient) {
+		c.background = ctx
+		c.revalidations = wg
+	}
 }
 
-func InitHTTP(cache Cache) {
+func InitHTTP(cache Cache, opts ...HTTPOption) {
 	cc := &cacheClient{
-		cache:     cache,
-		transport: http.DefaultTransport,
+		cache:      cache,
+		transport:  http.DefaultTransport,
+		staleGrace: DefaultStaleGrace,
+	}
+
+	for _, opt := range opts {
+		opt(cc)
 	}
 
+	// requests time out in RoundTrip, after HTTPTimeout or the timeout set
+	// by the app, so the client doesn't set one of its own
 	httpClient := &http.Client{
 		Transport: cc,
-		Timeout:   HTTPTimeout * 2,
 	}
+
+	if cc.guard != nil {
+		if cc.transport == http.DefaultTransport {
+			cc.transport = cc.guard.Transport()
+		}
+		httpClient.CheckRedirect = cc.guard.CheckRedirect
+		starlarkhttp.StarlarkHTTPGuard = cc.guard
+	}
+
 	starlarkhttp.StarlarkHTTPClient = httpClient
 }
 
@@ -67,7 +159,12 @@ func InitHTTP(cache Cache) {
 func (c *cacheClient) RoundTrip(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
 
-	ctx, cancel := context.WithTimeout(ctx, HTTPTimeout)
+	timeout := HTTPTimeout
+	if t, ok := starlarkhttp.RequestTimeout(ctx); ok {
+		timeout = t
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel() // need to do this to not leak a goroutine
 
 	key, err := cacheKey(req)
@@ -75,35 +172,305 @@ func (c *cacheClient) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, fmt.Errorf("failed to generate cache key: %w", err)
 	}
 
-	if req.Method == "GET" || req.Method == "HEAD" || req.Method == "POST" {
+	tracer := tracing.FromContext(req.Context())
+
+	// retries are made because the response was an error, which may be
+	// cached, so they go straight to the server
+	retry := starlarkhttp.RequestAttempt(ctx) > 0
+
+	var stale *staleResponse
+
+	if (req.Method == "GET" || req.Method == "HEAD" || req.Method == "POST") && !retry {
+		span := tracer.Start("cache", "httpcache.Get").SetURL(req.URL)
 		b, exists, err := c.cache.Get(nil, key)
+		span.SetAttr("hit", exists && err == nil).End()
 		if exists && err == nil {
-			if res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req); err == nil {
-				res.Header.Set("tidbyt-cache-status", "HIT")
-				return res, nil
+			res, fresh := c.readCached(b, req)
+			if fresh {
+				res.Header.Set(CacheStatusHeader, "HIT")
+				return res.Response, nil
+			}
+			stale = res
+
+			// stale-while-revalidate
+			if stale != nil && stale.age < stale.whileRevalidate {
+				c.revalidateInBackground(key, req, b)
+				stale.Header.Set(CacheStatusHeader, "STALE")
+				return stale.Response, nil
 			}
 		}
 	}
 
-	resp, err := c.transport.RoundTrip(req.WithContext(ctx))
+	return c.fetch(ctx, key, req, stale)
+}
+
+// staleResponse is a cached response that has expired.
+type staleResponse struct {
+	*http.Response
+
+	// age is how long ago the response expired.
+	age time.Duration
+
+	// ifError is how long after expiring the response can be served if
+	// the server fails, and whileRevalidate how long it can be served
+	// while it's revalidated in the background.
+	ifError         time.Duration
+	whileRevalidate time.Duration
+}
+
+// readCached reads a response to req from b, which was read from the cache,
+// and reports whether it's still fresh. It returns nil if b can't be read.
+func (c *cacheClient) readCached(b []byte, req *http.Request) (res *staleResponse, fresh bool) {
+	r, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	if err != nil {
+		return nil, false
+	}
+
+	res = &staleResponse{Response: r}
+	expires, ok := cachedExpiry(r)
+	if !ok || c.now().Before(expires) {
+		return res, true
+	}
+
+	res.age = c.now().Sub(expires)
+	res.ifError, res.whileRevalidate = c.staleWindows(req, r)
+	return res, false
+}
+
+// fetch sends req to the server, and caches the response under key. If stale
+// is set, it's revalidated if it can be, and served instead of the response
+// if the server fails.
+func (c *cacheClient) fetch(ctx context.Context, key string, req *http.Request, stale *staleResponse) (*http.Response, error) {
+	outReq := req.WithContext(ctx)
+	revalidating := stale != nil && canRevalidate(req, stale.Response)
+	if revalidating {
+		outReq = req.Clone(ctx)
+		if etag := stale.Header.Get("ETag"); etag != "" {
+			outReq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := stale.Header.Get("Last-Modified"); lastModified != "" {
+			outReq.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	span := tracing.FromContext(ctx).Start("http", "RoundTrip").SetURL(req.URL)
+	if revalidating {
+		span.SetAttr("revalidating", true)
+	}
+	resp, err := c.transport.RoundTrip(outReq)
+	if err != nil {
+		span.SetAttr("error", err.Error())
+	}
+	span.End()
 	if err == nil {
 		resp.Body = http.MaxBytesReader(nil, resp.Body, MaxResponseBytes)
 	}
 
+	// stale-if-error: a failure isn't cached over a response that can
+	// still be served in its place
+	if stale != nil && stale.age < stale.ifError && (err != nil || resp.StatusCode >= 500) {
+		if err == nil {
+			resp.Body.Close()
+		}
+		stale.Header.Set(CacheStatusHeader, "STALE")
+		return stale.Response, nil
+	}
+
+	if err == nil && revalidating && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+
+		// the server confirmed that the stale response is still good, and
+		// may have sent new headers for it, e.g. with a new max-age
+		for name, values := range resp.Header {
+			if name == "Content-Length" || name == "Transfer-Encoding" {
+				continue
+			}
+			stale.Header[name] = values
+		}
+
+		if err := c.store(ctx, key, req, stale.Response); err != nil {
+			return nil, err
+		}
+		stale.Header.Set(CacheStatusHeader, "REVALIDATED")
+		return stale.Response, nil
+	}
+
 	if err == nil && (req.Method == "GET" || req.Method == "HEAD" || req.Method == "POST") {
-		ser, err := httputil.DumpResponse(resp, true)
+		if err := c.store(ctx, key, req, resp); err != nil {
+			return nil, err
+		}
+		resp.Header.Set(CacheStatusHeader, "MISS")
+	}
+
+	return resp, err
+}
+
+// revalidateInBackground fetches req again, to refresh the stale response
+// cached under key, which was read from b and has been served to the app.
+// Only one request for each key is made at a time. Failures are recorded by
+// the tracer of req, since nothing is waiting for the result.
+func (c *cacheClient) revalidateInBackground(key string, req *http.Request, b []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.revalidating[key] {
+		return
+	}
+	if c.revalidating == nil {
+		c.revalidating = map[string]bool{}
+	}
+	c.revalidating[key] = true
+
+	tracer := tracing.FromContext(req.Context())
+
+	background := c.background
+	if background == nil {
+		background = context.Background()
+	}
+
+	if c.revalidations != nil {
+		c.revalidations.Add(1)
+	}
+
+	go func() {
+		if c.revalidations != nil {
+			defer c.revalidations.Done()
+		}
+		defer func() {
+			c.mutex.Lock()
+			delete(c.revalidating, key)
+			c.mutex.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(tracing.NewContext(background, tracer), HTTPTimeout)
+		defer cancel()
+
+		span := tracer.Start("http", "revalidate").SetURL(req.URL)
+		defer span.End()
+
+		req := req.Clone(ctx)
+		stale, _ := c.readCached(b, req)
+		if stale == nil {
+			return
+		}
+
+		resp, err := c.fetch(ctx, key, req, stale)
 		if err != nil {
-			// if httputil.DumpResponse fails, it leaves the response body in an
-			// undefined state, so we cannot continue
-			return nil, fmt.Errorf("failed to serialize response for cache: %s", resp.Status)
+			span.SetAttr("error", err.Error())
+			return
 		}
+		resp.Body.Close()
 
-		ttl := DetermineTTL(req, resp)
-		c.cache.Set(nil, key, ser, int64(ttl.Seconds()))
-		resp.Header.Set("tidbyt-cache-status", "MISS")
+		if resp.Header.Get(CacheStatusHeader) == "STALE" {
+			span.SetAttr("error", "request failed, kept the stale response")
+		}
+	}()
+}
+
+// store caches resp, the response to req, under key. Expired responses are
+// kept for as long as they can be served stale, and those that can be
+// revalidated for as long again as they were fresh.
+func (c *cacheClient) store(ctx context.Context, key string, req *http.Request, resp *http.Response) error {
+	ttl := DetermineTTL(req, resp)
+
+	ifError, whileRevalidate := c.staleWindows(req, resp)
+	keep := max(ifError, whileRevalidate)
+	if canRevalidate(req, resp) {
+		keep = max(keep, ttl)
 	}
+	retention := ttl + keep
 
-	return resp, err
+	resp.Header.Set(cacheExpiresHeader, strconv.FormatInt(c.now().Add(ttl).Unix(), 10))
+	ser, err := httputil.DumpResponse(resp, true)
+	resp.Header.Del(cacheExpiresHeader)
+	if err != nil {
+		// if httputil.DumpResponse fails, it leaves the response body in an
+		// undefined state, so we cannot continue
+		return fmt.Errorf("failed to serialize response for cache: %s", resp.Status)
+	}
+
+	span := tracing.FromContext(ctx).Start("cache", "httpcache.Set").
+		SetURL(req.URL).
+		SetAttr("ttl_seconds", int64(ttl.Seconds()))
+	c.cache.Set(nil, key, ser, int64(retention.Seconds()))
+	span.End()
+
+	return nil
+}
+
+// staleWindows returns how long after expiring res, the response to req, can
+// be served if the server fails, and while it's revalidated in the background.
+// Responses are served stale if the server fails for as long as their
+// stale-if-error directive allows, or the cache's stale grace window if they
+// don't have one, and while revalidating only if they allow it with
+// stale-while-revalidate. Directives are limited to MaxStaleAge.
+func (c *cacheClient) staleWindows(req *http.Request, res *http.Response) (ifError, whileRevalidate time.Duration) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return 0, 0
+	}
+
+	if res.StatusCode >= 400 {
+		return 0, 0
+	}
+
+	directives := parseCacheControl(res.Header.Get("Cache-Control"))
+	for _, d := range []string{"must-revalidate", "proxy-revalidate", "no-cache", "no-store"} {
+		if _, ok := directives[d]; ok {
+			return 0, 0
+		}
+	}
+
+	ifError = c.staleGrace
+	if seconds, ok := directives["stale-if-error"].(int); ok {
+		ifError = min(time.Duration(seconds)*time.Second, MaxStaleAge)
+	}
+
+	if seconds, ok := directives["stale-while-revalidate"].(int); ok {
+		whileRevalidate = min(time.Duration(seconds)*time.Second, MaxStaleAge)
+	}
+
+	return ifError, whileRevalidate
+}
+
+func (c *cacheClient) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
+
+// cachedExpiry returns when res, which was read from the cache, expires, and
+// removes the header that it's kept in. Responses cached without one expire
+// along with their cache record.
+func cachedExpiry(res *http.Response) (time.Time, bool) {
+	header := res.Header.Get(cacheExpiresHeader)
+	res.Header.Del(cacheExpiresHeader)
+
+	unix, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(unix, 0), true
+}
+
+// canRevalidate reports whether res, the response to req, can be revalidated
+// with a conditional request once it expires. Requests that are conditional
+// already are left to the app.
+func canRevalidate(req *http.Request, res *http.Response) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+
+	return res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""
 }
 
 func cacheKey(req *http.Request) (string, error) {
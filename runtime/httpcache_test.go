@@ -3,13 +3,21 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 func TestInitHTTP(t *testing.T) {
@@ -183,3 +191,443 @@ func TestDetermineTTLNoHeaders(t *testing.T) {
 	ttl := DetermineTTL(req, res)
 	assert.Equal(t, MinRequestTTL, ttl)
 }
+
+func TestInitHTTPWithNetworkGuard(t *testing.T) {
+	defer func() { starlarkhttp.StarlarkHTTPGuard = nil }()
+
+	src := `
+load("http.star", "http")
+load("render.star", "render")
+
+def main():
+    http.get("http://169.254.169.254/latest/meta-data/")
+    return render.Root(child=render.Box())
+`
+	InitHTTP(NewInMemoryCache(), WithNetworkGuard(&starlarkhttp.NetworkGuard{}))
+
+	app, err := NewApplet("test.star", []byte(src))
+	assert.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	assert.ErrorContains(t, err, "request to 169.254.169.254 blocked")
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	etag := `"v1"`
+	var full, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.Header().Set("Cache-Control", "max-age=120")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		full++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "body %s", etag)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	cc := &cacheClient{
+		cache:     NewInMemoryCache(),
+		transport: http.DefaultTransport,
+		clock:     func() time.Time { return now },
+	}
+
+	get := func() (string, string) {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Empty(t, res.Header.Get(cacheExpiresHeader))
+		return res.Header.Get(CacheStatusHeader), string(b)
+	}
+
+	status, body := get()
+	assert.Equal(t, "MISS", status)
+	assert.Equal(t, `body "v1"`, body)
+
+	status, _ = get()
+	assert.Equal(t, "HIT", status)
+
+	// once expired, the response is revalidated rather than fetched again
+	now = now.Add(2 * time.Minute)
+	status, body = get()
+	assert.Equal(t, "REVALIDATED", status)
+	assert.Equal(t, `body "v1"`, body)
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 1, notModified)
+
+	// and is fresh again, for the max-age given with the 304
+	now = now.Add(90 * time.Second)
+	status, _ = get()
+	assert.Equal(t, "HIT", status)
+
+	// a response that has changed is fetched in full
+	now = now.Add(time.Hour)
+	etag = `"v2"`
+	status, body = get()
+	assert.Equal(t, "MISS", status)
+	assert.Equal(t, `body "v2"`, body)
+	assert.Equal(t, 2, full)
+	assert.Equal(t, 1, notModified)
+}
+
+func TestCacheRevalidationLastModified(t *testing.T) {
+	lastModified := "Mon, 01 Jun 2026 00:00:00 GMT"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	cc := &cacheClient{
+		cache:     NewInMemoryCache(),
+		transport: http.DefaultTransport,
+		clock:     func() time.Time { return now },
+	}
+
+	for _, expected := range []string{"MISS", "REVALIDATED"} {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, res.Header.Get(CacheStatusHeader))
+		assert.Equal(t, 200, res.StatusCode)
+
+		now = now.Add(time.Hour)
+	}
+}
+
+func TestCacheWithoutValidators(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("If-None-Match"))
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	cc := &cacheClient{
+		cache:     NewInMemoryCache(),
+		transport: http.DefaultTransport,
+		clock:     func() time.Time { return now },
+	}
+
+	for _, expected := range []string{"MISS", "MISS"} {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, res.Header.Get(CacheStatusHeader))
+
+		now = now.Add(time.Hour)
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	var failing atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	cc := &cacheClient{
+		cache:      NewInMemoryCache(),
+		transport:  http.DefaultTransport,
+		clock:      func() time.Time { return now },
+		staleGrace: time.Hour,
+	}
+
+	get := func() (int, string, string) {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, res.Header.Get(CacheStatusHeader), string(b)
+	}
+
+	code, status, _ := get()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "MISS", status)
+
+	// the server fails after the response expires, so it's served stale
+	failing.Store(true)
+	now = now.Add(10 * time.Minute)
+	code, status, body := get()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "STALE", status)
+	assert.Equal(t, "hello", body)
+
+	// and the failure isn't cached over it
+	code, status, _ = get()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "STALE", status)
+
+	// until the grace window is over
+	now = now.Add(time.Hour)
+	code, status, _ = get()
+	assert.Equal(t, 503, code)
+	assert.Equal(t, "MISS", status)
+}
+
+func TestCacheStaleIfErrorNeedsDirective(t *testing.T) {
+	for cacheControl, expected := range map[string]int{
+		"max-age=60":                     503,
+		"max-age=60, stale-if-error=600": 200,
+	} {
+		var failing atomic.Bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Cache-Control", cacheControl)
+		}))
+
+		// without a grace window, only responses that allow it are served
+		// stale, and the upstream error surfaces for the others
+		now := time.Now()
+		cc := &cacheClient{
+			cache:      NewInMemoryCache(),
+			transport:  http.DefaultTransport,
+			clock:      func() time.Time { return now },
+			staleGrace: DefaultStaleGrace,
+		}
+
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		_, err = cc.RoundTrip(req)
+		require.NoError(t, err)
+
+		failing.Store(true)
+		now = now.Add(5 * time.Minute)
+
+		req, err = http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, res.StatusCode, cacheControl)
+
+		ts.Close()
+	}
+}
+
+func TestCacheStaleIfErrorConnection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	url := ts.URL
+
+	now := time.Now()
+	cc := &cacheClient{
+		cache:      NewInMemoryCache(),
+		transport:  http.DefaultTransport,
+		clock:      func() time.Time { return now },
+		staleGrace: time.Hour,
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	_, err = cc.RoundTrip(req)
+	require.NoError(t, err)
+
+	ts.Close()
+	now = now.Add(time.Minute)
+
+	req, err = http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	res, err := cc.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "STALE", res.Header.Get(CacheStatusHeader))
+}
+
+func TestCacheStaleDirectives(t *testing.T) {
+	for cacheControl, expected := range map[string]string{
+		"max-age=60":                        "STALE",
+		"max-age=60, stale-if-error=600":    "STALE",
+		"max-age=60, stale-if-error=60":     "MISS",
+		"max-age=60, must-revalidate":       "MISS",
+		"max-age=60, proxy-revalidate":      "MISS",
+		"max-age=60, no-cache":              "MISS",
+		"max-age=60, stale-if-error=999999": "STALE",
+	} {
+		var failing atomic.Bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Cache-Control", cacheControl)
+		}))
+
+		now := time.Now()
+		cc := &cacheClient{
+			cache:      NewInMemoryCache(),
+			transport:  http.DefaultTransport,
+			clock:      func() time.Time { return now },
+			staleGrace: time.Hour,
+		}
+
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		_, err = cc.RoundTrip(req)
+		require.NoError(t, err)
+
+		failing.Store(true)
+		now = now.Add(5 * time.Minute)
+
+		req, err = http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, res.Header.Get(CacheStatusHeader), cacheControl)
+
+		ts.Close()
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	requests := make(chan bool, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=300")
+		fmt.Fprintf(w, "v%d", version.Load())
+		requests <- true
+	}))
+	defer ts.Close()
+
+	var mutex sync.Mutex
+	now := time.Now()
+	cc := &cacheClient{
+		cache:     NewInMemoryCache(),
+		transport: http.DefaultTransport,
+		clock: func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return now
+		},
+		staleGrace: time.Hour,
+	}
+
+	get := func() (string, string) {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.Header.Get(CacheStatusHeader), string(b)
+	}
+
+	status, body := get()
+	assert.Equal(t, "MISS", status)
+	assert.Equal(t, "v1", body)
+	<-requests
+
+	// the expired response is served straight away, and refreshed in the
+	// background
+	version.Store(2)
+	mutex.Lock()
+	now = now.Add(2 * time.Minute)
+	mutex.Unlock()
+
+	status, body = get()
+	assert.Equal(t, "STALE", status)
+	assert.Equal(t, "v1", body)
+	<-requests
+
+	assert.Eventually(t, func() bool {
+		status, body := get()
+		return status == "HIT" && body == "v2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+// blockingTransport fails requests once their context is done, after
+// reporting them on started.
+type blockingTransport struct {
+	started chan bool
+}
+
+func (t *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.started <- true
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestCacheBackgroundRevalidation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=300")
+		fmt.Fprint(w, "v1")
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	now := time.Now()
+	cc := &cacheClient{
+		cache:      NewInMemoryCache(),
+		transport:  http.DefaultTransport,
+		clock:      func() time.Time { return now },
+		staleGrace: time.Hour,
+	}
+	WithBackgroundRevalidation(ctx, &wg)(cc)
+
+	tracer := tracing.NewTracer()
+	get := func() string {
+		req, err := http.NewRequestWithContext(tracing.NewContext(context.Background(), tracer), "GET", ts.URL, nil)
+		require.NoError(t, err)
+		res, err := cc.RoundTrip(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.Header.Get(CacheStatusHeader)
+	}
+
+	assert.Equal(t, "MISS", get())
+
+	// the revalidation hangs until it's cancelled
+	transport := &blockingTransport{started: make(chan bool, 1)}
+	cc.transport = transport
+	now = now.Add(2 * time.Minute)
+
+	assert.Equal(t, "STALE", get())
+	<-transport.started
+
+	cancel()
+	wg.Wait()
+
+	// the failure is reported in the trace
+	events := map[string]tracing.Event{}
+	for _, e := range tracer.Events() {
+		events[e.Name] = e
+	}
+	require.Contains(t, events, "revalidate")
+	assert.Equal(t, ts.URL, events["revalidate"].Args["url"])
+	assert.Equal(t, "request failed, kept the stale response", events["revalidate"].Args["error"])
+	assert.Contains(t, events["RoundTrip"].Args["error"], "context canceled")
+}
@@ -0,0 +1,238 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/hybrid"
+	"github.com/google/tink/go/insecurecleartextkeyset"
+	"github.com/google/tink/go/keyset"
+	"github.com/google/tink/go/tink"
+)
+
+const (
+	// KeyEncryptionKeyEnv is the environment variable holding the path of the
+	// local key-encryption key, overriding DefaultKeyEncryptionKeyPath.
+	KeyEncryptionKeyEnv = "PIXLET_KEK"
+
+	// DefaultKeysetFileName is the conventional name of a private keyset
+	// for secrets, encrypted with the local key-encryption key.
+	DefaultKeysetFileName = "pixlet.keyset.json"
+)
+
+// DefaultKeyEncryptionKeyPath returns the path of the local key-encryption
+// key, which is set in KeyEncryptionKeyEnv, or kept in the user's config
+// directory otherwise.
+func DefaultKeyEncryptionKeyPath() (string, error) {
+	if path := os.Getenv(KeyEncryptionKeyEnv); path != "" {
+		return path, nil
+	}
+
+	ucd, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding config directory: %w", err)
+	}
+
+	return filepath.Join(ucd, "tidbyt", "kek.json"), nil
+}
+
+// GenerateKeyEncryptionKey creates a local key-encryption key at path, and
+// returns it. The key is stored in cleartext, readable only by the user, and
+// protects the private keysets generated with it.
+func GenerateKeyEncryptionKey(path string) (tink.AEAD, error) {
+	kh, err := keyset.NewHandle(aead.AES256GCMKeyTemplate())
+	if err != nil {
+		return nil, fmt.Errorf("generating key-encryption key: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := insecurecleartextkeyset.Write(kh, keyset.NewJSONWriter(buf)); err != nil {
+		return nil, fmt.Errorf("serializing key-encryption key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("writing key-encryption key: %w", err)
+	}
+
+	// O_EXCL, so that an existing key, and every keyset it protects, is
+	// never lost
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("writing key-encryption key: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing key-encryption key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("writing key-encryption key: %w", err)
+	}
+
+	return aead.New(kh)
+}
+
+// LoadKeyEncryptionKey reads a local key-encryption key.
+func LoadKeyEncryptionKey(path string) (tink.AEAD, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key-encryption key: %w", err)
+	}
+
+	kh, err := insecurecleartextkeyset.Read(keyset.NewJSONReader(bytes.NewReader(b)))
+	if err != nil {
+		return nil, fmt.Errorf("reading key-encryption key %s: %w", path, err)
+	}
+
+	kek, err := aead.New(kh)
+	if err != nil {
+		return nil, fmt.Errorf("reading key-encryption key %s: %w", path, err)
+	}
+
+	return kek, nil
+}
+
+// LoadOrGenerateKeyEncryptionKey reads the local key-encryption key at path,
+// creating it if it doesn't exist yet. created reports whether it did.
+func LoadOrGenerateKeyEncryptionKey(path string) (kek tink.AEAD, created bool, err error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		kek, err := GenerateKeyEncryptionKey(path)
+		return kek, err == nil, err
+	}
+
+	kek, err = LoadKeyEncryptionKey(path)
+	return kek, false, err
+}
+
+// GenerateSecretDecryptionKey creates a new private keyset for secrets,
+// protected by kek.
+func GenerateSecretDecryptionKey(kek tink.AEAD) (*SecretDecryptionKey, error) {
+	kh, err := keyset.NewHandle(hybrid.ECIESHKDFAES128CTRHMACSHA256KeyTemplate())
+	if err != nil {
+		return nil, fmt.Errorf("generating keyset: %w", err)
+	}
+
+	sdk := &SecretDecryptionKey{KeyEncryptionKey: kek}
+	if err := sdk.setHandle(kh); err != nil {
+		return nil, err
+	}
+
+	return sdk, nil
+}
+
+// LoadSecretDecryptionKey reads a private keyset for secrets that's
+// protected by kek.
+func LoadSecretDecryptionKey(path string, kek tink.AEAD) (*SecretDecryptionKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyset: %w", err)
+	}
+
+	sdk := &SecretDecryptionKey{
+		EncryptedKeysetJSON: b,
+		KeyEncryptionKey:    kek,
+	}
+
+	// fail early if the keyset was protected by another key-encryption key
+	if _, err := sdk.handle(); err != nil {
+		return nil, fmt.Errorf("reading keyset %s: %w", path, err)
+	}
+
+	return sdk, nil
+}
+
+// EncryptionKey returns the public keyset matching the private keyset, for
+// encrypting secrets that it can decrypt.
+func (sdk *SecretDecryptionKey) EncryptionKey() (*SecretEncryptionKey, error) {
+	kh, err := sdk.handle()
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := kh.Public()
+	if err != nil {
+		return nil, fmt.Errorf("getting public keyset: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := pub.WriteWithNoSecrets(keyset.NewJSONWriter(buf)); err != nil {
+		return nil, fmt.Errorf("serializing public keyset: %w", err)
+	}
+
+	return &SecretEncryptionKey{PublicKeysetJSON: buf.Bytes()}, nil
+}
+
+// Rotate adds a new key to the keyset and makes it the primary key, which
+// secrets are encrypted for from now on. Older keys are kept, so secrets
+// that were encrypted for them can still be decrypted. It returns the ID of
+// the new key.
+func (sdk *SecretDecryptionKey) Rotate() (uint32, error) {
+	kh, err := sdk.handle()
+	if err != nil {
+		return 0, err
+	}
+
+	manager := keyset.NewManagerFromHandle(kh)
+	keyID, err := manager.Add(hybrid.ECIESHKDFAES128CTRHMACSHA256KeyTemplate())
+	if err != nil {
+		return 0, fmt.Errorf("adding key: %w", err)
+	}
+	if err := manager.SetPrimary(keyID); err != nil {
+		return 0, fmt.Errorf("setting primary key: %w", err)
+	}
+
+	kh, err = manager.Handle()
+	if err != nil {
+		return 0, fmt.Errorf("rotating keyset: %w", err)
+	}
+
+	if err := sdk.setHandle(kh); err != nil {
+		return 0, err
+	}
+
+	return keyID, nil
+}
+
+func (sdk *SecretDecryptionKey) handle() (*keyset.Handle, error) {
+	r := bytes.NewReader(sdk.EncryptedKeysetJSON)
+	kh, err := keyset.Read(keyset.NewJSONReader(r), sdk.KeyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "reading keyset JSON", err)
+	}
+	return kh, nil
+}
+
+func (sdk *SecretDecryptionKey) setHandle(kh *keyset.Handle) error {
+	buf := &bytes.Buffer{}
+	if err := kh.Write(keyset.NewJSONWriter(buf), sdk.KeyEncryptionKey); err != nil {
+		return fmt.Errorf("encrypting keyset: %w", err)
+	}
+
+	sdk.EncryptedKeysetJSON = buf.Bytes()
+	return nil
+}
+
+// isEncryptedKeysetJSON reports whether b is the JSON of a keyset that's
+// encrypted with a key-encryption key, rather than a cleartext one.
+func isEncryptedKeysetJSON(b []byte) bool {
+	var ks struct {
+		EncryptedKeyset string `json:"encryptedKeyset"`
+	}
+	return json.Unmarshal(b, &ks) == nil && ks.EncryptedKeyset != ""
+}
+
+// isCleartextKeysetJSON reports whether b is a Tink keyset in cleartext JSON,
+// as key-encryption keys are stored.
+func isCleartextKeysetJSON(b []byte) bool {
+	var ks struct {
+		Key []struct {
+			KeyData json.RawMessage `json:"keyData"`
+		} `json:"key"`
+	}
+	return json.Unmarshal(b, &ks) == nil && len(ks.Key) > 0 && ks.Key[0].KeyData != nil
+}
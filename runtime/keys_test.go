@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretKeysRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	kekPath := filepath.Join(dir, "kek.json")
+
+	kek, created, err := LoadOrGenerateKeyEncryptionKey(kekPath)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// the key-encryption key is never replaced
+	_, err = GenerateKeyEncryptionKey(kekPath)
+	assert.Error(t, err)
+
+	key, err := GenerateSecretDecryptionKey(kek)
+	require.NoError(t, err)
+
+	pub, err := key.EncryptionKey()
+	require.NoError(t, err)
+	before, err := pub.Encrypt("weather", "before_rotation")
+	require.NoError(t, err)
+
+	_, err = key.Rotate()
+	require.NoError(t, err)
+
+	pub, err = key.EncryptionKey()
+	require.NoError(t, err)
+	after, err := pub.Encrypt("weather", "after_rotation")
+	require.NoError(t, err)
+
+	// round trip through files, as the keys commands do
+	require.NoError(t, os.WriteFile(filepath.Join(dir, DefaultKeysetFileName), key.EncryptedKeysetJSON, 0600))
+	secretsPath := filepath.Join(dir, LocalSecretsFileName)
+	require.NoError(t, os.WriteFile(secretsPath, []byte(fmt.Sprintf(`
+keyset: %s
+kek: kek.json
+app_id: weather
+`, DefaultKeysetFileName)), 0600))
+
+	kek, created, err = LoadOrGenerateKeyEncryptionKey(kekPath)
+	require.NoError(t, err)
+	assert.False(t, created)
+	_, err = LoadSecretDecryptionKey(filepath.Join(dir, DefaultKeysetFileName), kek)
+	require.NoError(t, err)
+
+	secrets, err := LoadLocalSecrets(secretsPath)
+	require.NoError(t, err)
+
+	src := fmt.Sprintf(`
+load("assert.star", "assert")
+load("render.star", "render")
+load("secret.star", "secret")
+
+def main():
+    assert.eq(secret.decrypt(%q), "before_rotation")
+    assert.eq(secret.decrypt(%q), "after_rotation")
+    return render.Root(child=render.Box())
+`, before, after)
+
+	app, err := NewApplet("weather.star", []byte(src), WithLocalSecrets(secrets))
+	require.NoError(t, err)
+	_, err = app.Run(context.Background())
+	assert.NoError(t, err)
+
+	// a keyset can't be read with another key-encryption key
+	otherKEK, err := GenerateKeyEncryptionKey(filepath.Join(dir, "other.json"))
+	require.NoError(t, err)
+	_, err = LoadSecretDecryptionKey(filepath.Join(dir, DefaultKeysetFileName), otherKEK)
+	assert.Error(t, err)
+}
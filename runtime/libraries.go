@@ -0,0 +1,259 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// LibraryPathEnv is the environment variable holding the library path,
+	// as a list of directories separated by the OS path list separator.
+	LibraryPathEnv = "PIXLET_LIBRARY_PATH"
+
+	// LibraryLockFileName is the name of the file in an app's root directory
+	// that pins the contents of the library files it loads.
+	LibraryLockFileName = "pixlet.lock"
+
+	libraryHashPrefix = "sha256:"
+)
+
+var libraryNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// LibraryPathFromEnv returns the library path set in LibraryPathEnv.
+func LibraryPathFromEnv() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(LibraryPathEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// LibraryPath returns the directories to search for libraries: dirs, e.g.
+// given on the command line, followed by those in LibraryPathEnv. The result
+// is a new slice, so dirs is never modified.
+func LibraryPath(dirs []string) []string {
+	return append(append([]string{}, dirs...), LibraryPathFromEnv()...)
+}
+
+// parseLibraryLabel turns a label like @teamlib//weather/api.star into the
+// path where the library file is found in an app's filesystem, which is
+// @teamlib/weather/api.star.
+func parseLibraryLabel(label string) (string, error) {
+	name, file, ok := strings.Cut(strings.TrimPrefix(label, "@"), "//")
+	if !ok || !libraryNameRe.MatchString(name) || !fs.ValidPath(file) || file == "." {
+		return "", fmt.Errorf("invalid library label %s, expected @<library>//<path>", label)
+	}
+
+	return "@" + name + "/" + file, nil
+}
+
+// libraryRoot returns the directory holding the library that p belongs to,
+// e.g. @teamlib for @teamlib/weather/api.star, or an empty string if p isn't
+// part of a library.
+func libraryRoot(p string) string {
+	if !strings.HasPrefix(p, "@") {
+		return ""
+	}
+	root, _, _ := strings.Cut(p, "/")
+	return root
+}
+
+// WithLibraryPath makes the shared libraries in the directories on path
+// available to the applet, by loading it from a LibraryFS.
+func WithLibraryPath(path []string) AppletOption {
+	return func(a *Applet) error {
+		a.libraryPath = path
+		return nil
+	}
+}
+
+// LibraryFS is an app's filesystem combined with the shared libraries on a
+// library path. Files of a library named teamlib, which apps load with
+// load("@teamlib//file.star", ...), appear in the @teamlib directory.
+//
+// Libraries that are part of the app's filesystem, e.g. in a bundle, are
+// used as is. Otherwise, each directory on the library path is searched for
+// a directory named after the library.
+//
+// If the app has a lockfile, files read from the library path must match the
+// hashes in it.
+type LibraryFS struct {
+	App  fs.FS
+	Path []string
+
+	// Lock is the app's lockfile, or nil if it doesn't have one.
+	Lock *LibraryLock
+}
+
+// NewLibraryFS combines app with the libraries found on path, and reads
+// app's lockfile if it has one.
+func NewLibraryFS(app fs.FS, path []string) (*LibraryFS, error) {
+	lock, err := ReadLibraryLock(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LibraryFS{
+		App:  app,
+		Path: path,
+		Lock: lock,
+	}, nil
+}
+
+func (lfs *LibraryFS) Open(name string) (fs.File, error) {
+	if libraryRoot(name) == "" {
+		return lfs.App.Open(name)
+	}
+
+	if f, err := lfs.App.Open(name); err == nil {
+		return f, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// the library directories are named without the @
+	libName := strings.TrimPrefix(name, "@")
+	for _, dir := range lfs.Path {
+		dirFS := os.DirFS(dir)
+
+		info, err := fs.Stat(dirFS, libName)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		if !info.IsDir() {
+			if err := lfs.verify(name, dirFS, libName); err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+		}
+
+		return dirFS.Open(libName)
+	}
+
+	return nil, &fs.PathError{
+		Op:   "open",
+		Path: name,
+		Err:  fmt.Errorf("%w (is the library on the library path?)", fs.ErrNotExist),
+	}
+}
+
+// verify checks a library file against the lockfile, if there is one.
+func (lfs *LibraryFS) verify(name string, dirFS fs.FS, libName string) error {
+	if lfs.Lock == nil {
+		return nil
+	}
+
+	want, ok := lfs.Lock.Libraries[name]
+	if !ok {
+		return fmt.Errorf("not in %s, run `pixlet lock` to add it", LibraryLockFileName)
+	}
+
+	b, err := fs.ReadFile(dirFS, libName)
+	if err != nil {
+		return err
+	}
+
+	if got := hashLibraryFile(b); got != want {
+		return fmt.Errorf(
+			"contents don't match %s (expected %s, found %s), run `pixlet lock` to update it",
+			LibraryLockFileName, want, got,
+		)
+	}
+
+	return nil
+}
+
+// LibraryLock pins the contents of the library files that an app loads.
+type LibraryLock struct {
+	// Libraries maps the path of each library file, e.g.
+	// @teamlib/weather.star, to the hash of its contents.
+	Libraries map[string]string `json:"libraries"`
+}
+
+// ReadLibraryLock reads the lockfile from an app's filesystem. It returns nil
+// if there is none.
+func ReadLibraryLock(app fs.FS) (*LibraryLock, error) {
+	b, err := fs.ReadFile(app, LibraryLockFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", LibraryLockFileName, err)
+	}
+
+	lock := &LibraryLock{}
+	if err := json.Unmarshal(b, lock); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", LibraryLockFileName, err)
+	}
+
+	if lock.Libraries == nil {
+		lock.Libraries = map[string]string{}
+	}
+
+	return lock, nil
+}
+
+// LockLibraries returns a lockfile for the library files loaded by the
+// applet, reading their contents from fsys.
+func (a *Applet) LockLibraries(fsys fs.FS) (*LibraryLock, error) {
+	lock := &LibraryLock{Libraries: map[string]string{}}
+
+	paths := a.PathsForBundle()
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if libraryRoot(p) == "" {
+			continue
+		}
+
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p, err)
+		}
+
+		lock.Libraries[p] = hashLibraryFile(b)
+	}
+
+	return lock, nil
+}
+
+// MarshalIndent returns the lockfile as it's stored on disk.
+func (l *LibraryLock) MarshalIndent() ([]byte, error) {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func hashLibraryFile(b []byte) string {
+	h := sha256.Sum256(b)
+	return libraryHashPrefix + hex.EncodeToString(h[:])
+}
+
+// checkLibraryLoad checks that a relative load from a library file stays
+// within that library.
+func checkLibraryLoad(from, modulePath, module string) error {
+	root := libraryRoot(from)
+	if root == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(modulePath, root+"/") {
+		return fmt.Errorf("%s is outside of the library %s", module, root)
+	}
+
+	return nil
+}
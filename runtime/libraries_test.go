@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var libraryTestSrc = `
+load("render.star", "render")
+load("@teamlib//weather/format.star", "format")
+
+def main():
+    if format.temp(21.4) != "21°":
+        fail("something went wrong")
+    return render.Root(child=render.Box())
+`
+
+// writeLibrary writes files to a library named name in a new library path
+// directory, and returns the directory.
+func writeLibrary(t *testing.T, name string, files map[string]string) string {
+	dir := t.TempDir()
+	for p, content := range files {
+		full := filepath.Join(dir, name, p)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestLibraries(t *testing.T) {
+	empty := t.TempDir()
+	dir := writeLibrary(t, "teamlib", map[string]string{
+		"weather/format.star": `
+load("../common.star", "common")
+
+def _temp(t):
+    return common.round(t) + "°"
+
+format = struct(temp = _temp)
+`,
+		"common.star": `
+def _round(f):
+    return str(int(f + 0.5))
+
+common = struct(round = _round)
+`,
+	})
+
+	vfs := fstest.MapFS{"app.star": {Data: []byte(libraryTestSrc)}}
+
+	// without a library path, the library can't be found
+	_, err := NewAppletFromFS("test", vfs)
+	assert.ErrorContains(t, err, "reading @teamlib/weather/format.star")
+
+	// the first directory with the library is used
+	app, err := NewAppletFromFS("test", vfs, WithLibraryPath([]string{empty, dir}))
+	require.NoError(t, err)
+	_, err = app.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		"app.star",
+		"@teamlib/weather/format.star",
+		"@teamlib/common.star",
+	}, app.PathsForBundle())
+
+	// libraries that are part of the app, as in bundles, don't need a
+	// library path
+	vfs["@teamlib/weather/format.star"] = &fstest.MapFile{Data: []byte(`format = struct(temp = lambda t: "21°")`)}
+	app, err = NewAppletFromFS("test", vfs)
+	require.NoError(t, err)
+	_, err = app.Run(context.Background())
+	require.NoError(t, err)
+}
+
+func TestLibraryLoadsStayInLibrary(t *testing.T) {
+	dir := writeLibrary(t, "teamlib", map[string]string{
+		"weather/format.star": `load("../../secrets.star", "secrets")`,
+	})
+
+	vfs := fstest.MapFS{
+		"app.star":     {Data: []byte(libraryTestSrc)},
+		"secrets.star": {Data: []byte(`secrets = 42`)},
+	}
+
+	_, err := NewAppletFromFS("test", vfs, WithLibraryPath([]string{dir}))
+	assert.ErrorContains(t, err, "../../secrets.star is outside of the library @teamlib")
+
+	vfs["app.star"] = &fstest.MapFile{Data: []byte(`load("@teamlib/..//x.star", "x")`)}
+	_, err = NewAppletFromFS("test", vfs, WithLibraryPath([]string{dir}))
+	assert.ErrorContains(t, err, "invalid library label")
+}
+
+func TestLibraryLock(t *testing.T) {
+	dir := writeLibrary(t, "teamlib", map[string]string{
+		"weather/format.star": `format = struct(temp = lambda t: "21°")`,
+	})
+
+	vfs := fstest.MapFS{"app.star": {Data: []byte(libraryTestSrc)}}
+
+	lfs := &LibraryFS{App: vfs, Path: []string{dir}}
+	app, err := NewAppletFromFS("test", lfs)
+	require.NoError(t, err)
+
+	lock, err := app.LockLibraries(lfs)
+	require.NoError(t, err)
+	require.Len(t, lock.Libraries, 1)
+	assert.Regexp(t, "^sha256:[0-9a-f]{64}$", lock.Libraries["@teamlib/weather/format.star"])
+
+	b, err := lock.MarshalIndent()
+	require.NoError(t, err)
+	vfs[LibraryLockFileName] = &fstest.MapFile{Data: b}
+
+	_, err = NewAppletFromFS("test", vfs, WithLibraryPath([]string{dir}))
+	assert.NoError(t, err)
+
+	// changes to the library are caught
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "teamlib", "weather", "format.star"),
+		[]byte(`format = struct(temp = lambda t: "22°")`),
+		0644,
+	))
+	_, err = NewAppletFromFS("test", vfs, WithLibraryPath([]string{dir}))
+	assert.ErrorContains(t, err, "contents don't match pixlet.lock")
+
+	// as are library files that aren't in the lockfile
+	vfs[LibraryLockFileName] = &fstest.MapFile{Data: []byte(`{"libraries": {}}`)}
+	_, err = NewAppletFromFS("test", vfs, WithLibraryPath([]string{dir}))
+	assert.ErrorContains(t, err, "not in pixlet.lock")
+}
+
+func TestLibraryPath(t *testing.T) {
+	t.Setenv(LibraryPathEnv, "/env/one"+string(filepath.ListSeparator)+"/env/two")
+
+	// appending the environment must not write into the backing array of
+	// the flag values
+	flags := make([]string, 1, 4)
+	flags[0] = "/flag"
+
+	assert.Equal(t, []string{"/flag", "/env/one", "/env/two"}, LibraryPath(flags))
+	assert.Empty(t, flags[:2][1])
+	assert.Equal(t, []string{"/env/one", "/env/two"}, LibraryPath(nil))
+}
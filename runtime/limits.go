@@ -0,0 +1,127 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+
+	"go.starlark.net/starlark"
+
+	"tidbyt.dev/pixlet/render"
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+)
+
+// Limits caps the resources an applet may use. Execution steps and HTTP
+// usage are counted separately for every call into the applet, so that each
+// run of main() gets a fresh budget. A zero value for any field means that
+// it isn't limited.
+type Limits struct {
+	// MaxExecutionSteps is the maximum number of Starlark computation steps.
+	MaxExecutionSteps uint64
+
+	// MaxHTTPRequests is the maximum number of HTTP requests.
+	MaxHTTPRequests int
+
+	// MaxHTTPResponseBytes is the maximum number of HTTP response body bytes
+	// read.
+	MaxHTTPResponseBytes int64
+
+	// MaxFrames is the maximum number of frames the returned roots may
+	// render to.
+	MaxFrames int
+}
+
+// LimitExceededError is returned when an applet goes over one of its Limits.
+type LimitExceededError struct {
+	// Limit describes the limit that was exceeded, for example
+	// "execution steps".
+	Limit string
+	Max   int64
+
+	// Err is the error raised by the applet when the limit was hit,
+	// including its backtrace, if any.
+	Err error
+}
+
+func (e *LimitExceededError) Error() string {
+	msg := fmt.Sprintf("exceeded limit of %d %s", e.Max, e.Limit)
+	if e.Err != nil {
+		msg += "\n" + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *LimitExceededError) Unwrap() error {
+	return e.Err
+}
+
+// WithLimits sets execution budgets for the applet. Runs that exceed them
+// fail with a LimitExceededError.
+func WithLimits(limits Limits) AppletOption {
+	return func(a *Applet) error {
+		a.limits = limits
+		a.initializers = append(a.initializers, func(t *starlark.Thread) *starlark.Thread {
+			if limits.MaxExecutionSteps > 0 {
+				t.SetMaxExecutionSteps(limits.MaxExecutionSteps)
+			}
+
+			if limits.MaxHTTPRequests > 0 || limits.MaxHTTPResponseBytes > 0 {
+				starlarkhttp.AttachBudget(t, &starlarkhttp.Budget{
+					MaxRequests:      limits.MaxHTTPRequests,
+					MaxResponseBytes: limits.MaxHTTPResponseBytes,
+				})
+			}
+
+			return t
+		})
+		return nil
+	}
+}
+
+// limitExceeded checks whether err, raised while running thread t, was caused
+// by the applet going over its limits. If so, it returns a
+// LimitExceededError wrapping reported, which is the error as it should be
+// shown to the user. Otherwise, it returns nil.
+func (a *Applet) limitExceeded(t *starlark.Thread, err error, reported error) error {
+	max := a.limits.MaxExecutionSteps
+	if max > 0 && t.ExecutionSteps() >= max {
+		return &LimitExceededError{
+			Limit: "execution steps",
+			Max:   int64(max),
+			Err:   reported,
+		}
+	}
+
+	var budgetErr *starlarkhttp.ErrBudgetExceeded
+	if errors.As(err, &budgetErr) {
+		return &LimitExceededError{
+			Limit: budgetErr.Limit,
+			Max:   budgetErr.Max,
+			Err:   reported,
+		}
+	}
+
+	return nil
+}
+
+// checkFrameLimit returns a LimitExceededError if roots render to more frames
+// than allowed.
+func (a *Applet) checkFrameLimit(roots []render.Root) error {
+	if a.limits.MaxFrames <= 0 {
+		return nil
+	}
+
+	frames := 0
+	for _, r := range roots {
+		frames += r.Child.FrameCount()
+	}
+
+	if frames > a.limits.MaxFrames {
+		return &LimitExceededError{
+			Limit: "frames",
+			Max:   int64(a.limits.MaxFrames),
+			Err:   fmt.Errorf("app returned %d frames", frames),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsExecutionSteps(t *testing.T) {
+	src := `
+load("render.star", "render")
+
+def main():
+    n = 0
+    for i in range(1000000):
+        n += i
+    return render.Root(child=render.Text(str(n)))
+`
+	app, err := NewApplet("test.star", []byte(src), WithLimits(Limits{MaxExecutionSteps: 10000}))
+	require.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	var limitErr *LimitExceededError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "execution steps", limitErr.Limit)
+	assert.Equal(t, int64(10000), limitErr.Max)
+	assert.ErrorContains(t, err, "too many steps")
+
+	// the budget is per run, and a bigger one is enough
+	app, err = NewApplet("test.star", []byte(src), WithLimits(Limits{MaxExecutionSteps: 100000000}))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = app.Run(context.Background())
+		assert.NoError(t, err)
+	}
+}
+
+func TestLimitsExecutionStepsAtLoad(t *testing.T) {
+	src := `
+load("render.star", "render")
+
+N = len([i for i in range(1000000)])
+
+def main():
+    return render.Root(child=render.Box())
+`
+	_, err := NewApplet("test.star", []byte(src), WithLimits(Limits{MaxExecutionSteps: 10000}))
+	var limitErr *LimitExceededError
+	assert.ErrorAs(t, err, &limitErr)
+}
+
+func TestLimitsHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 100))
+	}))
+	defer ts.Close()
+	InitHTTP(NewInMemoryCache())
+
+	src := fmt.Sprintf(`
+load("http.star", "http")
+load("render.star", "render")
+
+def main(config):
+    for i in range(int(config.get("requests"))):
+        http.get("%s/" + str(i)).body()
+    return render.Root(child=render.Box())
+`, ts.URL)
+
+	app, err := NewApplet("test.star", []byte(src), WithLimits(Limits{
+		MaxHTTPRequests:      3,
+		MaxHTTPResponseBytes: 250,
+	}))
+	require.NoError(t, err)
+
+	_, err = app.RunWithConfig(context.Background(), map[string]string{"requests": "2"})
+	assert.NoError(t, err)
+
+	// the third response goes over the byte limit
+	_, err = app.RunWithConfig(context.Background(), map[string]string{"requests": "3"})
+	var limitErr *LimitExceededError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "HTTP response bytes", limitErr.Limit)
+	assert.Equal(t, int64(250), limitErr.Max)
+
+	app, err = NewApplet("test.star", []byte(src), WithLimits(Limits{MaxHTTPRequests: 3}))
+	require.NoError(t, err)
+
+	_, err = app.RunWithConfig(context.Background(), map[string]string{"requests": "4"})
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "HTTP requests", limitErr.Limit)
+	assert.Equal(t, int64(3), limitErr.Max)
+}
+
+func TestLimitsFrames(t *testing.T) {
+	src := `
+load("render.star", "render")
+
+def main():
+    return [
+        render.Root(child=render.Animation(children=[render.Box()] * 10)),
+        render.Root(child=render.Box()),
+    ]
+`
+	app, err := NewApplet("test.star", []byte(src), WithLimits(Limits{MaxFrames: 11}))
+	require.NoError(t, err)
+
+	roots, err := app.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, roots, 2)
+
+	app, err = NewApplet("test.star", []byte(src), WithLimits(Limits{MaxFrames: 10}))
+	require.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	var limitErr *LimitExceededError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "frames", limitErr.Limit)
+	assert.ErrorContains(t, err, "app returned 11 frames")
+}
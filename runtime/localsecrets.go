@@ -0,0 +1,296 @@
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/tink/go/hybrid"
+	"github.com/google/tink/go/insecurecleartextkeyset"
+	"github.com/google/tink/go/keyset"
+	"github.com/google/tink/go/tink"
+	"go.starlark.net/starlark"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LocalSecretsFileName is the conventional name of a local secrets file.
+	// Files with this name, and the keys that they refer to, are never
+	// written to bundles, and bundling fails on any other file that
+	// IsSecretFile accepts.
+	LocalSecretsFileName = "pixlet.secrets.yaml"
+
+	// redactedSecret replaces the plaintext of secrets in output.
+	redactedSecret = "[REDACTED]"
+
+	// minRedactedSecretLength is the length below which secrets aren't
+	// redacted, since short values would match too much unrelated output.
+	minRedactedSecretLength = 4
+)
+
+// LocalSecrets stand in for the Tidbyt cloud's secret decryption key when
+// developing apps locally. They're usually read from a YAML file:
+//
+//	secrets:
+//	  "AV6+xWcE...": top_secret_api_key_123456
+//	  weather_api_key: top_secret_api_key_123456
+//	keyset: pixlet.keyset.json
+//
+// secret.decrypt() first looks up its argument in the secrets. Keys can be
+// encrypted values, as in the app's source, or names that the app passes to
+// secret.decrypt() during development. Anything else is decrypted with the
+// keyset, if there is one, and returns None otherwise.
+type LocalSecrets struct {
+	Secrets map[string]string `yaml:"secrets"`
+
+	// Keyset is the path to a private Tink keyset for decrypting values
+	// encrypted with its public keyset. It's either encrypted with a local
+	// key-encryption key, as created by `pixlet keys generate`, or in
+	// cleartext JSON. Relative paths are relative to the secrets file.
+	Keyset string `yaml:"keyset"`
+
+	// KEK is the path to the key-encryption key of an encrypted keyset. It
+	// defaults to DefaultKeyEncryptionKeyPath.
+	KEK string `yaml:"kek"`
+
+	// AppID is the app ID that values were encrypted for. It defaults to the
+	// ID of the applet.
+	AppID string `yaml:"app_id"`
+
+	decrypt tink.HybridDecrypt
+}
+
+// LoadLocalSecrets reads local secrets from a YAML file.
+func LoadLocalSecrets(path string) (*LocalSecrets, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets file: %w", err)
+	}
+
+	ls := &LocalSecrets{}
+	if err := yaml.Unmarshal(b, ls); err != nil {
+		// the YAML error could quote the file, so it's left out
+		return nil, fmt.Errorf("parsing secrets file %s: invalid YAML", path)
+	}
+
+	if ls.Keyset != "" {
+		keysetPath := ls.Keyset
+		if !filepath.IsAbs(keysetPath) {
+			keysetPath = filepath.Join(filepath.Dir(path), keysetPath)
+		}
+
+		kb, err := os.ReadFile(keysetPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading keyset: %w", err)
+		}
+
+		if isEncryptedKeysetJSON(kb) {
+			kekPath := ls.KEK
+			if kekPath == "" {
+				if kekPath, err = DefaultKeyEncryptionKeyPath(); err != nil {
+					return nil, err
+				}
+			} else if !filepath.IsAbs(kekPath) {
+				kekPath = filepath.Join(filepath.Dir(path), kekPath)
+			}
+
+			kek, err := LoadKeyEncryptionKey(kekPath)
+			if err != nil {
+				return nil, err
+			}
+
+			err = ls.SetDecryptionKey(&SecretDecryptionKey{
+				EncryptedKeysetJSON: kb,
+				KeyEncryptionKey:    kek,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("reading keyset %s: %w", keysetPath, err)
+			}
+		} else {
+			kh, err := insecurecleartextkeyset.Read(keyset.NewJSONReader(bytes.NewReader(kb)))
+			if err != nil {
+				return nil, fmt.Errorf("reading keyset %s: %w", keysetPath, err)
+			}
+
+			if ls.decrypt, err = hybrid.NewHybridDecrypt(kh); err != nil {
+				return nil, fmt.Errorf("reading keyset %s: %w", keysetPath, err)
+			}
+		}
+	}
+
+	return ls, nil
+}
+
+// LocalSecretsKeyFiles returns the paths of the keyset and key-encryption key
+// that b, the contents of a local secrets file, refers to, as they're written
+// in it. Relative paths are relative to the secrets file.
+func LocalSecretsKeyFiles(b []byte) []string {
+	ls := &LocalSecrets{}
+	if yaml.Unmarshal(b, ls) != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, p := range []string{ls.Keyset, ls.KEK} {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// IsSecretFile reports whether b, the contents of a file, holds secrets or
+// the keys to them: a local secrets file, or a Tink keyset such as a private
+// keyset or a key-encryption key, whether encrypted or not.
+func IsSecretFile(b []byte) bool {
+	if isEncryptedKeysetJSON(b) || isCleartextKeysetJSON(b) {
+		return true
+	}
+
+	var ls struct {
+		Secrets map[string]string `yaml:"secrets"`
+		Keyset  string            `yaml:"keyset"`
+	}
+	if yaml.Unmarshal(b, &ls) != nil {
+		return false
+	}
+	return len(ls.Secrets) > 0 || ls.Keyset != ""
+}
+
+// SetDecryptionKey makes the local secrets decrypt values that aren't in
+// Secrets with key.
+func (ls *LocalSecrets) SetDecryptionKey(key *SecretDecryptionKey) error {
+	kh, err := key.handle()
+	if err != nil {
+		return err
+	}
+
+	dec, err := hybrid.NewHybridDecrypt(kh)
+	if err != nil {
+		return fmt.Errorf("%s: %w", "NewHybridDecrypt", err)
+	}
+
+	ls.decrypt = dec
+	return nil
+}
+
+// WithLocalSecrets makes secret.decrypt() return values from local secrets.
+// The plaintext of secrets is redacted from the applet's print output, from
+// errors returned by Call and from RunResult.
+func WithLocalSecrets(ls *LocalSecrets) AppletOption {
+	return func(a *Applet) error {
+		redactor := &secretRedactor{}
+		for _, plaintext := range ls.Secrets {
+			redactor.add(plaintext)
+		}
+		a.redactor = redactor
+
+		appID := ls.AppID
+		if appID == "" {
+			appID = a.ID
+		}
+
+		dec := ls.decrypterForApp(appID, redactor)
+		a.initializers = append(a.initializers, func(t *starlark.Thread) *starlark.Thread {
+			dec.attachToThread(t)
+			return t
+		})
+
+		return nil
+	}
+}
+
+func (ls *LocalSecrets) decrypterForApp(appID string, redactor *secretRedactor) decrypter {
+	context := []byte(appID)
+
+	return func(s starlark.String) (starlark.Value, error) {
+		if plaintext, ok := ls.Secrets[s.GoString()]; ok {
+			return starlark.String(plaintext), nil
+		}
+
+		// encrypted values may be wrapped over several lines
+		v := regexp.MustCompile(`\s`).ReplaceAllString(s.GoString(), "")
+		if plaintext, ok := ls.Secrets[v]; ok {
+			return starlark.String(plaintext), nil
+		}
+
+		if ls.decrypt == nil {
+			return starlark.None, nil
+		}
+
+		plaintext, err := decryptSecret(ls.decrypt, context, s)
+		if err != nil {
+			return nil, err
+		}
+
+		redactor.add(plaintext.GoString())
+		return plaintext, nil
+	}
+}
+
+// secretRedactor removes the plaintext of secrets from strings.
+type secretRedactor struct {
+	mutex    sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+func (r *secretRedactor) add(value string) {
+	if len(value) < minRedactedSecretLength {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, v := range r.values {
+		if v == value {
+			return
+		}
+	}
+	r.values = append(r.values, value)
+
+	// replace longer values first, in case one secret contains another
+	sort.Slice(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+
+	oldnew := make([]string, 0, 2*len(r.values))
+	for _, v := range r.values {
+		oldnew = append(oldnew, v, redactedSecret)
+	}
+	r.replacer = strings.NewReplacer(oldnew...)
+}
+
+func (r *secretRedactor) redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// attachToThread redacts secrets from everything the thread prints. It must
+// be called after anything else that wraps the thread's print function, so
+// that they don't see the plaintext either.
+func (r *secretRedactor) attachToThread(t *starlark.Thread) {
+	print := t.Print
+	if print == nil {
+		return
+	}
+
+	t.Print = func(thread *starlark.Thread, msg string) {
+		print(thread, r.redact(msg))
+	}
+}
@@ -0,0 +1,154 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/tink/go/hybrid"
+	"github.com/google/tink/go/insecurecleartextkeyset"
+	"github.com/google/tink/go/keyset"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+var localSecretsSrc = `
+load("assert.star", "assert")
+load("render.star", "render")
+load("secret.star", "secret")
+
+def main():
+    assert.eq(secret.decrypt("api_key"), "named_secret_value")
+    assert.eq(secret.decrypt("AV6+\nblob"), "blob_secret_value")
+
+    from_keyset = secret.decrypt(%q)
+    assert.eq(from_keyset, "keyset_secret_value")
+
+    print("key is " + secret.decrypt("api_key") + ", other is " + from_keyset)
+    return render.Root(child=render.Box())
+
+def test_fail():
+    fail("bad key: " + secret.decrypt("api_key"))
+`
+
+func TestLocalSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	// make a local keyset, and encrypt a secret with its public keyset
+	kh, err := keyset.NewHandle(hybrid.ECIESHKDFAES128CTRHMACSHA256KeyTemplate())
+	require.NoError(t, err)
+
+	f, err := os.Create(filepath.Join(dir, "keyset.json"))
+	require.NoError(t, err)
+	require.NoError(t, insecurecleartextkeyset.Write(kh, keyset.NewJSONWriter(f)))
+	require.NoError(t, f.Close())
+
+	pub, err := kh.Public()
+	require.NoError(t, err)
+	pubJSON := &bytes.Buffer{}
+	require.NoError(t, pub.WriteWithNoSecrets(keyset.NewJSONWriter(pubJSON)))
+	encrypted, err := (&SecretEncryptionKey{PublicKeysetJSON: pubJSON.Bytes()}).Encrypt("testid", "keyset_secret_value")
+	require.NoError(t, err)
+
+	secretsPath := filepath.Join(dir, LocalSecretsFileName)
+	require.NoError(t, os.WriteFile(secretsPath, []byte(`
+secrets:
+  api_key: named_secret_value
+  "AV6+blob": blob_secret_value
+keyset: keyset.json
+`), 0600))
+
+	secrets, err := LoadLocalSecrets(secretsPath)
+	require.NoError(t, err)
+
+	var printed []string
+	app, err := NewApplet(
+		"testid",
+		[]byte(fmt.Sprintf(localSecretsSrc, encrypted)),
+		WithPrintFunc(func(_ *starlark.Thread, msg string) { printed = append(printed, msg) }),
+		WithLocalSecrets(secrets),
+	)
+	require.NoError(t, err)
+
+	result, err := app.RunWithResult(context.Background(), nil)
+	require.NoError(t, err)
+
+	// plaintext is redacted from output
+	assert.Equal(t, []string{"key is [REDACTED], other is [REDACTED]"}, printed)
+	assert.Equal(t, printed, result.Prints)
+
+	results := app.RunTestFunctions(context.Background(), nil)
+	require.Len(t, results, 1)
+	require.Len(t, results[0].Failures, 1)
+	assert.Contains(t, results[0].Failures[0], "bad key: [REDACTED]")
+	assert.NotContains(t, results[0].Failures[0], "named_secret_value")
+}
+
+func TestLocalSecretsWithoutKeyset(t *testing.T) {
+	secretsPath := filepath.Join(t.TempDir(), LocalSecretsFileName)
+	require.NoError(t, os.WriteFile(secretsPath, []byte("secrets:\n  api_key: abc\n"), 0600))
+
+	secrets, err := LoadLocalSecrets(secretsPath)
+	require.NoError(t, err)
+
+	app, err := NewApplet("testid", []byte(`
+load("assert.star", "assert")
+load("render.star", "render")
+load("secret.star", "secret")
+
+def main():
+    assert.eq(secret.decrypt("api_key"), "abc")
+    assert.eq(secret.decrypt("unknown"), None)
+    assert.eq(secret.decrypt(base64_blob), None)
+    return render.Root(child=render.Box())
+
+base64_blob = "`+base64.StdEncoding.EncodeToString([]byte("not a secret"))+`"
+`), WithLocalSecrets(secrets))
+	require.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	assert.NoError(t, err)
+
+	// YAML errors could quote the secrets, so they aren't reported
+	require.NoError(t, os.WriteFile(secretsPath, []byte("secrets: [top_secret_value"), 0600))
+	_, err = LoadLocalSecrets(secretsPath)
+	assert.ErrorContains(t, err, "invalid YAML")
+	assert.NotContains(t, err.Error(), "top_secret_value")
+}
+
+func TestIsSecretFile(t *testing.T) {
+	kekPath := filepath.Join(t.TempDir(), "kek.json")
+	kek, err := GenerateKeyEncryptionKey(kekPath)
+	require.NoError(t, err)
+	kekJSON, err := os.ReadFile(kekPath)
+	require.NoError(t, err)
+
+	key, err := GenerateSecretDecryptionKey(kek)
+	require.NoError(t, err)
+
+	assert.True(t, IsSecretFile(kekJSON))
+	assert.True(t, IsSecretFile(key.EncryptedKeysetJSON))
+	assert.True(t, IsSecretFile([]byte("secrets:\n  api_key: top_secret_value\n")))
+	assert.True(t, IsSecretFile([]byte("keyset: keys/app.keyset.json\n")))
+
+	assert.False(t, IsSecretFile([]byte("def main():\n    return []\n")))
+	assert.False(t, IsSecretFile([]byte(`{"key": "value"}`)))
+	assert.False(t, IsSecretFile([]byte("id: weather\nname: Weather\n")))
+	assert.False(t, IsSecretFile([]byte{0xff, 0xd8, 0xff, 0xe0}))
+}
+
+func TestLocalSecretsKeyFiles(t *testing.T) {
+	assert.Equal(t, []string{"keys/app.keyset.json", "/etc/kek.json"}, LocalSecretsKeyFiles([]byte(`
+secrets:
+  api_key: top_secret_value
+keyset: keys/app.keyset.json
+kek: /etc/kek.json
+`)))
+	assert.Empty(t, LocalSecretsKeyFiles([]byte("secrets:\n  api_key: top_secret_value\n")))
+	assert.Empty(t, LocalSecretsKeyFiles([]byte("not: [yaml")))
+}
@@ -0,0 +1,374 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	starlibbsoup "github.com/qri-io/starlib/bsoup"
+	starlibgzip "github.com/qri-io/starlib/compress/gzip"
+	starlibbase64 "github.com/qri-io/starlib/encoding/base64"
+	starlibcsv "github.com/qri-io/starlib/encoding/csv"
+	starlibhash "github.com/qri-io/starlib/hash"
+	starlibhtml "github.com/qri-io/starlib/html"
+	starlibre "github.com/qri-io/starlib/re"
+	starlibzip "github.com/qri-io/starlib/zipfile"
+	starlibjson "go.starlark.net/lib/json"
+	starlibmath "go.starlark.net/lib/math"
+	starlibtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/starlarktest"
+
+	"tidbyt.dev/pixlet/runtime/modules/animation_runtime"
+	"tidbyt.dev/pixlet/runtime/modules/hmac"
+	"tidbyt.dev/pixlet/runtime/modules/httpmock"
+	"tidbyt.dev/pixlet/runtime/modules/humanize"
+	"tidbyt.dev/pixlet/runtime/modules/qrcode"
+	"tidbyt.dev/pixlet/runtime/modules/random"
+	"tidbyt.dev/pixlet/runtime/modules/render_runtime"
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+	"tidbyt.dev/pixlet/runtime/modules/sunrise"
+	"tidbyt.dev/pixlet/runtime/modules/xpath"
+	"tidbyt.dev/pixlet/schema"
+)
+
+// Module is a Go module that applets can load by name, e.g. with
+// load("render.star", "render").
+type Module struct {
+	// Name is what applets pass to load().
+	Name string
+
+	Description string
+
+	// NeedsNetwork reports whether the module makes network requests.
+	NeedsNetwork bool
+
+	// Deterministic reports whether the module's functions always give the
+	// same results for the same arguments. Modules that read the clock, use
+	// randomness or keep state between runs aren't deterministic.
+	Deterministic bool
+
+	// Load returns the module's globals.
+	Load func() (starlark.StringDict, error)
+}
+
+// ModuleRegistry is a set of modules, keyed by name. It's safe for
+// concurrent use.
+type ModuleRegistry struct {
+	mutex   sync.RWMutex
+	modules map[string]Module
+}
+
+// DefaultModules holds the modules available to every applet, which are
+// the built-in modules unless more are registered.
+var DefaultModules = NewModuleRegistry()
+
+func NewModuleRegistry() *ModuleRegistry {
+	return &ModuleRegistry{modules: map[string]Module{}}
+}
+
+// RegisterModule adds a module to DefaultModules. It panics if the module is
+// invalid or a module with the same name is already registered.
+func RegisterModule(m Module) {
+	if err := DefaultModules.Register(m); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds a module to the registry. It fails if a module with the same
+// name is already registered. Use Set to replace one.
+func (r *ModuleRegistry) Register(m Module) error {
+	if m.Name == "" || m.Load == nil {
+		return fmt.Errorf("module must have a name and a Load function")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.modules[m.Name]; ok {
+		return fmt.Errorf("module already registered: %s", m.Name)
+	}
+
+	r.modules[m.Name] = m
+	return nil
+}
+
+// Set adds a module to the registry, replacing any module with the same
+// name.
+func (r *ModuleRegistry) Set(m Module) error {
+	if m.Name == "" || m.Load == nil {
+		return fmt.Errorf("module must have a name and a Load function")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.modules[m.Name] = m
+	return nil
+}
+
+// Remove removes the named module from the registry, if present.
+func (r *ModuleRegistry) Remove(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.modules, name)
+}
+
+// Lookup returns the named module.
+func (r *ModuleRegistry) Lookup(name string) (Module, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	m, ok := r.modules[name]
+	return m, ok
+}
+
+// Modules returns all modules in the registry, sorted by name.
+func (r *ModuleRegistry) Modules() []Module {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	modules := make([]Module, 0, len(r.modules))
+	for _, m := range r.modules {
+		modules = append(modules, m)
+	}
+
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+
+	return modules
+}
+
+// Clone returns a copy of the registry, which can be changed without
+// affecting the original.
+func (r *ModuleRegistry) Clone() *ModuleRegistry {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	clone := NewModuleRegistry()
+	for name, m := range r.modules {
+		clone.modules[name] = m
+	}
+
+	return clone
+}
+
+// WithModules makes the modules in registry, instead of DefaultModules,
+// available to the applet. Later changes to registry don't affect the
+// applet.
+func WithModules(registry *ModuleRegistry) AppletOption {
+	return func(a *Applet) error {
+		a.modules = registry.Clone()
+		return nil
+	}
+}
+
+// WithModule makes a module available to the applet, replacing any module
+// with the same name.
+func WithModule(m Module) AppletOption {
+	return func(a *Applet) error {
+		return a.modules.Set(m)
+	}
+}
+
+// WithoutModules makes the named modules unavailable to the applet.
+func WithoutModules(names ...string) AppletOption {
+	return func(a *Applet) error {
+		for _, name := range names {
+			a.modules.Remove(name)
+		}
+		return nil
+	}
+}
+
+// Modules returns the modules available to the applet, sorted by name. It
+// doesn't include modules provided by a ModuleLoader.
+func (a *Applet) Modules() []Module {
+	return a.modules.Modules()
+}
+
+// HTTPMockModule gives canned responses to the HTTP requests made by tests.
+// It isn't one of the DefaultModules, so that apps can't load it; test
+// runners add it with WithModule.
+var HTTPMockModule = Module{
+	Name:        "http_mock.star",
+	Description: "Canned HTTP responses for tests",
+	Load:        httpmock.LoadModule,
+}
+
+// stringDictLoader returns a Load function for a module that's already
+// loaded.
+func stringDictLoader(module starlark.StringDict) func() (starlark.StringDict, error) {
+	return func() (starlark.StringDict, error) {
+		return module, nil
+	}
+}
+
+func init() {
+	for _, m := range []Module{
+		{
+			Name:          "render.star",
+			Description:   "Widgets for drawing app output",
+			Deterministic: true,
+			Load:          render_runtime.LoadRenderModule,
+		},
+		{
+			Name:          "animation.star",
+			Description:   "Keyframe animations of widgets",
+			Deterministic: true,
+			Load:          animation_runtime.LoadAnimationModule,
+		},
+		{
+			Name:          "schema.star",
+			Description:   "Configuration schema definitions",
+			Deterministic: true,
+			Load:          schema.LoadModule,
+		},
+		{
+			Name:        "cache.star",
+			Description: "Key-value cache that persists between runs",
+			Load:        LoadCacheModule,
+		},
+		{
+			Name:          "secret.star",
+			Description:   "Decryption of secrets embedded in apps",
+			Deterministic: true,
+			Load:          LoadSecretModule,
+		},
+		{
+			Name:          "xpath.star",
+			Description:   "XPath queries on XML documents",
+			Deterministic: true,
+			Load:          xpath.LoadXPathModule,
+		},
+		{
+			Name:          "bsoup.star",
+			Description:   "HTML parsing with a BeautifulSoup-like API",
+			Deterministic: true,
+			Load:          starlibbsoup.LoadModule,
+		},
+		{
+			Name:          "compress/gzip.star",
+			Description:   "Gzip decompression",
+			Deterministic: true,
+			Load: stringDictLoader(starlark.StringDict{
+				starlibgzip.Module.Name: starlibgzip.Module,
+			}),
+		},
+		{
+			Name:          "compress/zipfile.star",
+			Description:   "Reading zip archives",
+			Deterministic: true,
+			Load: func() (starlark.StringDict, error) {
+				// Starlib expects you to load the ZipFile function directly, rather than having it be part of a namespace.
+				// Wraps this to be more consistent with other pixlet modules, as follows:
+				//   load("compress/zipfile.star", "zipfile")
+				//   archive = zipfile.ZipFile("/tmp/foo.zip")
+				m, _ := starlibzip.LoadModule()
+				return starlark.StringDict{
+					"zipfile": &starlarkstruct.Module{
+						Name:    "zipfile",
+						Members: m,
+					},
+				}, nil
+			},
+		},
+		{
+			Name:          "encoding/base64.star",
+			Description:   "Base64 encoding and decoding",
+			Deterministic: true,
+			Load:          starlibbase64.LoadModule,
+		},
+		{
+			Name:          "encoding/csv.star",
+			Description:   "CSV encoding and decoding",
+			Deterministic: true,
+			Load:          starlibcsv.LoadModule,
+		},
+		{
+			Name:          "encoding/json.star",
+			Description:   "JSON encoding and decoding",
+			Deterministic: true,
+			Load: stringDictLoader(starlark.StringDict{
+				starlibjson.Module.Name: starlibjson.Module,
+			}),
+		},
+		{
+			Name:          "hash.star",
+			Description:   "MD5, SHA-1 and SHA-256 hashes",
+			Deterministic: true,
+			Load:          starlibhash.LoadModule,
+		},
+		{
+			Name:          "hmac.star",
+			Description:   "HMAC signatures",
+			Deterministic: true,
+			Load:          hmac.LoadModule,
+		},
+		{
+			Name:         "http.star",
+			Description:  "HTTP client with response caching",
+			NeedsNetwork: true,
+			Load:         starlarkhttp.LoadModule,
+		},
+		{
+			Name:          "html.star",
+			Description:   "HTML parsing with a jQuery-like API",
+			Deterministic: true,
+			Load:          starlibhtml.LoadModule,
+		},
+		{
+			Name:        "humanize.star",
+			Description: "Human-friendly formatting of numbers, sizes and times",
+			Load:        humanize.LoadModule,
+		},
+		{
+			Name:          "math.star",
+			Description:   "Mathematical functions and constants",
+			Deterministic: true,
+			Load: stringDictLoader(starlark.StringDict{
+				starlibmath.Module.Name: starlibmath.Module,
+			}),
+		},
+		{
+			Name:          "re.star",
+			Description:   "Regular expressions",
+			Deterministic: true,
+			Load:          starlibre.LoadModule,
+		},
+		{
+			Name:        "sunrise.star",
+			Description: "Sunrise and sunset times",
+			Load:        sunrise.LoadModule,
+		},
+		{
+			Name:        "time.star",
+			Description: "Times, durations and time zones",
+			Load: stringDictLoader(starlark.StringDict{
+				starlibtime.Module.Name: starlibtime.Module,
+			}),
+		},
+		{
+			Name:        "random.star",
+			Description: "Random numbers",
+			Load:        random.LoadModule,
+		},
+		{
+			Name:          "qrcode.star",
+			Description:   "QR code generation",
+			Deterministic: true,
+			Load:          qrcode.LoadModule,
+		},
+		{
+			Name:          "assert.star",
+			Description:   "Assertions for tests",
+			Deterministic: true,
+			Load:          starlarktest.LoadAssertModule,
+		},
+	} {
+		RegisterModule(m)
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"tidbyt.dev/pixlet/render"
 	"tidbyt.dev/pixlet/render/animation"
 	"tidbyt.dev/pixlet/runtime/modules/render_runtime"
+	"tidbyt.dev/pixlet/starlarkutil"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 type AnimationModule struct {
@@ -694,7 +696,11 @@ func newTransformation(
 
 	w.frame_count = starlark.NewBuiltin("frame_count", transformationFrameCount)
 
-	if err := w.Init(); err != nil {
+	span := tracing.FromContext(starlarkutil.ThreadContext(thread)).Start("render", "Transformation.Init")
+	span.SetAttr("widget", "Transformation")
+	err := w.Init()
+	span.End()
+	if err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,346 @@
+package httpmock
+
+// This module lets tests give canned responses to the requests that an app
+// makes with http.star, so that they don't depend on the network. Mocks are
+// registered on the thread that a test runs on, and the http module sends
+// the thread's requests to them instead of the real client.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	util "github.com/qri-io/starlib/util"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/starlarktest"
+
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+	"tidbyt.dev/pixlet/starlarkutil"
+)
+
+const (
+	ModuleName = "http_mock"
+
+	threadMocksKey = "tidbyt.dev/pixlet/runtime/modules/httpmock/mocks"
+)
+
+var (
+	once   sync.Once
+	module starlark.StringDict
+)
+
+func LoadModule() (starlark.StringDict, error) {
+	once.Do(func() {
+		module = starlark.StringDict{
+			ModuleName: &starlarkstruct.Module{
+				Name: ModuleName,
+				Members: starlark.StringDict{
+					"add":     starlark.NewBuiltin("add", fnAdd("")),
+					"get":     starlark.NewBuiltin("get", fnAdd(http.MethodGet)),
+					"put":     starlark.NewBuiltin("put", fnAdd(http.MethodPut)),
+					"post":    starlark.NewBuiltin("post", fnAdd(http.MethodPost)),
+					"delete":  starlark.NewBuiltin("delete", fnAdd(http.MethodDelete)),
+					"patch":   starlark.NewBuiltin("patch", fnAdd(http.MethodPatch)),
+					"options": starlark.NewBuiltin("options", fnAdd(http.MethodOptions)),
+				},
+			},
+		}
+	})
+
+	return module, nil
+}
+
+// mock is a canned response to the requests that match it.
+type mock struct {
+	// method is the request method to match, or "*" for any.
+	method string
+
+	// url matches the full URL of a request, including its query string.
+	url     *regexp.Regexp
+	pattern string
+
+	// matchBody, if set, is a glob or a callable that the request body has
+	// to match.
+	matchBody starlark.Value
+
+	statusCode int
+	headers    http.Header
+	body       []byte
+
+	// times is the number of requests that the mock expects, or -1 if any
+	// number is fine.
+	times int
+	calls int
+
+	// pos is where the mock was added, for reporting failures.
+	pos string
+
+	owner *mocks
+}
+
+// mocks holds the mocks added on a thread, and sends its requests to them.
+type mocks struct {
+	thread *starlark.Thread
+
+	mutex sync.Mutex
+	mocks []*mock
+}
+
+// threadMocks returns the mocks for thread, attaching them to it if this is
+// the first mock added on the thread.
+func threadMocks(thread *starlark.Thread) *mocks {
+	if m, ok := thread.Local(threadMocksKey).(*mocks); ok {
+		return m
+	}
+
+	m := &mocks{thread: thread}
+	thread.SetLocal(threadMocksKey, m)
+	starlarkhttp.AttachClient(thread, &http.Client{Transport: m})
+	starlarkutil.AddOnExit(thread, m.verify)
+
+	return m
+}
+
+func (m *mocks) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	m.mutex.Lock()
+	candidates := append([]*mock(nil), m.mocks...)
+	m.mutex.Unlock()
+
+	// the first mock added wins, so that tests can register a catch-all
+	// after more specific mocks
+	for _, mk := range candidates {
+		ok, err := mk.matches(m.thread, req, body)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		m.mutex.Lock()
+		mk.calls++
+		m.mutex.Unlock()
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", mk.statusCode, http.StatusText(mk.statusCode)),
+			StatusCode:    mk.statusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        mk.headers.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(mk.body)),
+			ContentLength: int64(len(mk.body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("http_mock: no mock for %s %s", req.Method, req.URL)
+}
+
+// verify reports every mock that wasn't called as many times as expected.
+func (m *mocks) verify() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reporter := starlarktest.GetReporter(m.thread)
+	for _, mk := range m.mocks {
+		if mk.times >= 0 && mk.calls != mk.times {
+			reporter.Error(fmt.Sprintf(
+				"%s: http_mock: %s %s was called %d times, want %d",
+				mk.pos, mk.method, mk.pattern, mk.calls, mk.times,
+			))
+		}
+	}
+}
+
+func (mk *mock) matches(thread *starlark.Thread, req *http.Request, body []byte) (bool, error) {
+	if mk.method != "*" && !strings.EqualFold(mk.method, req.Method) {
+		return false, nil
+	}
+
+	if !mk.url.MatchString(req.URL.String()) {
+		return false, nil
+	}
+
+	switch matcher := mk.matchBody.(type) {
+	case nil:
+		return true, nil
+
+	case starlark.String:
+		return globRegexp(string(matcher)).Match(body), nil
+
+	case starlark.Callable:
+		v, err := starlark.Call(thread, matcher, starlark.Tuple{starlark.String(body)}, nil)
+		if err != nil {
+			return false, fmt.Errorf("http_mock: match_body: %w", err)
+		}
+		return bool(v.Truth()), nil
+	}
+
+	return false, nil
+}
+
+func (mk *mock) Struct() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlark.String("mock"), starlark.StringDict{
+		"call_count": starlark.NewBuiltin("call_count", mk.callCount),
+	})
+}
+
+func (mk *mock) callCount(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+
+	mk.owner.mutex.Lock()
+	defer mk.owner.mutex.Unlock()
+
+	return starlark.MakeInt(mk.calls), nil
+}
+
+// fnAdd returns a builtin that adds a mock for requests with method. If
+// method is empty, the builtin takes it as its first argument.
+func fnAdd(method string) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			methodv    starlark.String
+			urlv       starlark.String
+			statusCode = 200
+			headers    = &starlark.Dict{}
+			body       starlark.String
+			jsonBody   starlark.Value
+			matchBody  starlark.Value
+			timesv     starlark.Value
+		)
+
+		params := []interface{}{
+			"url", &urlv,
+			"status_code?", &statusCode,
+			"headers?", &headers,
+			"body?", &body,
+			"json_body?", &jsonBody,
+			"match_body?", &matchBody,
+			"times?", &timesv,
+		}
+		if method == "" {
+			params = append([]interface{}{"method", &methodv}, params...)
+		}
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, params...); err != nil {
+			return nil, err
+		}
+
+		if !inTest(thread) {
+			return nil, fmt.Errorf("%s: http_mock can only be used in tests", fn.Name())
+		}
+
+		if statusCode < 100 || statusCode > 999 {
+			return nil, fmt.Errorf("%s: invalid status_code %d", fn.Name(), statusCode)
+		}
+
+		mk := &mock{
+			method:     strings.ToUpper(method),
+			pattern:    string(urlv),
+			url:        globRegexp(string(urlv)),
+			statusCode: statusCode,
+			headers:    http.Header{},
+			body:       []byte(body),
+			times:      -1,
+			pos:        thread.CallFrame(1).Pos.String(),
+		}
+		if method == "" {
+			mk.method = strings.ToUpper(string(methodv))
+		}
+
+		for _, item := range headers.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("%s: header keys must be strings, got %s", fn.Name(), item[0].Type())
+			}
+			val, ok := starlark.AsString(item[1])
+			if !ok {
+				return nil, fmt.Errorf("%s: header %q must be a string, got %s", fn.Name(), key, item[1].Type())
+			}
+			mk.headers.Add(key, val)
+		}
+
+		if jsonBody != nil && jsonBody != starlark.None {
+			if body != "" {
+				return nil, fmt.Errorf("%s: body and json_body can't both be set", fn.Name())
+			}
+
+			v, err := util.Unmarshal(jsonBody)
+			if err != nil {
+				return nil, fmt.Errorf("%s: json_body: %w", fn.Name(), err)
+			}
+			mk.body, err = json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: json_body: %w", fn.Name(), err)
+			}
+			if mk.headers.Get("Content-Type") == "" {
+				mk.headers.Set("Content-Type", "application/json")
+			}
+		}
+
+		switch matchBody.(type) {
+		case nil, starlark.String, starlark.Callable:
+		case starlark.NoneType:
+			matchBody = nil
+		default:
+			return nil, fmt.Errorf("%s: match_body must be a string or a function, got %s", fn.Name(), matchBody.Type())
+		}
+		mk.matchBody = matchBody
+
+		if timesv != nil && timesv != starlark.None {
+			times, err := starlark.AsInt32(timesv)
+			if err != nil || times < 0 {
+				return nil, fmt.Errorf("%s: times must be a non-negative int, got %s", fn.Name(), timesv)
+			}
+			mk.times = times
+		}
+
+		m := threadMocks(thread)
+		mk.owner = m
+		m.mutex.Lock()
+		m.mocks = append(m.mocks, mk)
+		m.mutex.Unlock()
+
+		return mk.Struct(), nil
+	}
+}
+
+// inTest reports whether thread is running a test, which is when it has a
+// reporter for the assert module.
+func inTest(thread *starlark.Thread) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	return starlarktest.GetReporter(thread) != nil
+}
+
+// globRegexp compiles a glob, in which * matches any run of characters,
+// into a regexp that matches whole strings.
+func globRegexp(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("(?s)^" + strings.Join(parts, ".*") + "$")
+}
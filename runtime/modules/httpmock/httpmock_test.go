@@ -0,0 +1,123 @@
+package httpmock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tidbyt.dev/pixlet/runtime"
+)
+
+var httpMockSrc = `
+load("assert.star", "assert")
+load("encoding/json.star", "json")
+load("http.star", "http")
+load("http_mock.star", "http_mock")
+
+def fetch_price(coin):
+    res = http.get("https://api.example.com/prices", params = {"coin": coin})
+    if res.status_code != 200:
+        return None
+    return res.json()["price"]
+
+def test_get():
+    http_mock.get("https://api.example.com/prices?coin=btc", json_body = {"price": 42})
+    http_mock.get("https://api.example.com/prices?*", status_code = 404)
+
+    assert.eq(fetch_price("btc"), 42)
+    assert.eq(fetch_price("eth"), None)
+
+def test_headers():
+    http_mock.get("https://example.com/", body = "<p>hi</p>", headers = {"Content-Type": "text/html"})
+
+    res = http.get("https://example.com/")
+    assert.eq(res.body(), "<p>hi</p>")
+    assert.eq(res.headers["Content-Type"], "text/html")
+
+def test_methods():
+    http_mock.post("https://example.com/*", body = "posted")
+    http_mock.add("*", "https://example.com/*", body = "any")
+
+    assert.eq(http.post("https://example.com/a").body(), "posted")
+    assert.eq(http.put("https://example.com/a").body(), "any")
+
+def test_match_body():
+    http_mock.post("https://example.com/", match_body = "*hello*", body = "glob")
+    http_mock.post("https://example.com/", match_body = lambda body: json.decode(body)["n"] > 1, body = "func")
+    http_mock.post("https://example.com/", body = "other")
+
+    assert.eq(http.post("https://example.com/", body = "well hello there").body(), "glob")
+    assert.eq(http.post("https://example.com/", json_body = {"n": 2}).body(), "func")
+    assert.eq(http.post("https://example.com/", json_body = {"n": 0}).body(), "other")
+
+def test_call_count():
+    mock = http_mock.get("https://example.com/", times = 2)
+    assert.eq(mock.call_count(), 0)
+
+    http.get("https://example.com/")
+    http.get("https://example.com/")
+    assert.eq(mock.call_count(), 2)
+
+def test_wrong_call_count():
+    http_mock.get("https://example.com/a", times = 1)
+    http_mock.get("https://example.com/b", times = 0)
+
+    http.get("https://example.com/b")
+
+def test_unmatched():
+    http_mock.get("https://example.com/")
+    http.get("https://example.org/")
+
+def main():
+    return []
+`
+
+func TestHTTPMock(t *testing.T) {
+	app, err := runtime.NewApplet("http_mock_test.star", []byte(httpMockSrc), runtime.WithModule(runtime.HTTPMockModule))
+	require.NoError(t, err)
+
+	results := map[string]*runtime.TestResult{}
+	for _, result := range app.RunTestFunctions(context.Background(), nil) {
+		results[result.Name] = result
+	}
+	require.Len(t, results, 7)
+
+	for _, name := range []string{"test_get", "test_headers", "test_methods", "test_match_body", "test_call_count"} {
+		result := results["http_mock_test.star/"+name]
+		assert.True(t, result.Passed(), "%s: %v", name, result.Failures)
+	}
+
+	failures := results["http_mock_test.star/test_wrong_call_count"].Failures
+	require.Len(t, failures, 2)
+	assert.Contains(t, failures[0], "http_mock_test.star:52:18: http_mock: GET https://example.com/a was called 0 times, want 1")
+	assert.Contains(t, failures[1], "http_mock_test.star:53:18: http_mock: GET https://example.com/b was called 1 times, want 0")
+
+	failures = results["http_mock_test.star/test_unmatched"].Failures
+	require.Len(t, failures, 1)
+	assert.Contains(t, failures[0], "http_mock: no mock for GET https://example.org/")
+}
+
+func TestHTTPMockOutsideTests(t *testing.T) {
+	app, err := runtime.NewApplet("app.star", []byte(`
+load("http_mock.star", "http_mock")
+
+def main():
+    http_mock.get("https://example.com/")
+    return []
+`), runtime.WithModule(runtime.HTTPMockModule))
+	require.NoError(t, err)
+
+	_, err = app.Run(context.Background())
+	assert.ErrorContains(t, err, "http_mock can only be used in tests")
+}
+
+func TestHTTPMockNotAvailableToApps(t *testing.T) {
+	_, err := runtime.NewApplet("app.star", []byte(`
+load("http_mock.star", "http_mock")
+
+def main():
+    return []
+`))
+	assert.ErrorContains(t, err, "invalid module: http_mock.star")
+}
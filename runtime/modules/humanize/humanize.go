@@ -13,6 +13,8 @@ import (
 	startime "go.starlark.net/lib/time"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
+
+	"tidbyt.dev/pixlet/starlarkutil"
 )
 
 const (
@@ -111,8 +113,9 @@ func times(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kw
 		return nil, fmt.Errorf("unpacking arguments for time: %s", err)
 	}
 
+	// same as gohumanize.Time, but relative to the thread's clock
 	date := time.Time(starDate)
-	val := gohumanize.Time(date)
+	val := gohumanize.RelTime(date, starlarkutil.ThreadNow(thread), "ago", "from now")
 
 	return starlark.String(val), nil
 }
@@ -171,7 +174,7 @@ func relativeTime(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tu
 		"relative_time",
 		args, kwargs,
 		"date_a", &starDateA,
-		"date_b", &starDateB,
+		"date_b?", &starDateB,
 		"label_a?", &starLabelA,
 		"label_b?", &starLabelB,
 	); err != nil {
@@ -180,6 +183,9 @@ func relativeTime(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tu
 
 	dateA := time.Time(starDateA)
 	dateB := time.Time(starDateB)
+	if dateB == empty {
+		dateB = starlarkutil.ThreadNow(thread)
+	}
 	val := gohumanize.RelTime(dateA, dateB, starLabelA.GoString(), starLabelB.GoString())
 	return starlark.String(val), nil
 }
@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"math/rand"
 	"sync"
-	"time"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
+
+	"tidbyt.dev/pixlet/starlarkutil"
 )
 
 const (
@@ -21,8 +22,11 @@ var (
 	module starlark.StringDict
 )
 
+// AttachToThread seeds an RNG for the thread. The seed is derived from the
+// thread's clock, so a clock must be attached to the thread first if one is
+// used.
 func AttachToThread(t *starlark.Thread) {
-	nowSeconds := time.Now().UnixMilli() / 1000
+	nowSeconds := starlarkutil.ThreadNow(t).UnixMilli() / 1000
 
 	t.SetLocal(
 		threadRandKey,
@@ -11,6 +11,8 @@ import (
 	"go.starlark.net/starlarkstruct"
 
 	"tidbyt.dev/pixlet/render"
+	"tidbyt.dev/pixlet/starlarkutil"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 type RenderModule struct {
@@ -612,7 +614,11 @@ func newImage(
 
 	w.frame_count = starlark.NewBuiltin("frame_count", imageFrameCount)
 
-	if err := w.Init(); err != nil {
+	span := tracing.FromContext(starlarkutil.ThreadContext(thread)).Start("render", "Image.Init")
+	span.SetAttr("widget", "Image")
+	err := w.Init()
+	span.End()
+	if err != nil {
 		return nil, err
 	}
 
@@ -1844,7 +1850,11 @@ func newText(
 
 	w.frame_count = starlark.NewBuiltin("frame_count", textFrameCount)
 
-	if err := w.Init(); err != nil {
+	span := tracing.FromContext(starlarkutil.ThreadContext(thread)).Start("render", "Text.Init")
+	span.SetAttr("widget", "Text")
+	err := w.Init()
+	span.End()
+	if err != nil {
 		return nil, err
 	}
 
@@ -1998,7 +2008,11 @@ func newWrappedText(
 
 	w.frame_count = starlark.NewBuiltin("frame_count", wrappedtextFrameCount)
 
-	if err := w.Init(); err != nil {
+	span := tracing.FromContext(starlarkutil.ThreadContext(thread)).Start("render", "WrappedText.Init")
+	span.SetAttr("widget", "WrappedText")
+	err := w.Init()
+	span.End()
+	if err != nil {
 		return nil, err
 	}
 
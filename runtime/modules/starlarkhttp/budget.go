@@ -0,0 +1,91 @@
+package starlarkhttp
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+const threadBudgetKey = "tidbyt.dev/pixlet/runtime/modules/starlarkhttp/budget"
+
+// Budget limits the HTTP requests made from a single Starlark thread. A zero
+// value for either limit means that it isn't enforced.
+type Budget struct {
+	MaxRequests      int
+	MaxResponseBytes int64
+
+	mutex         sync.Mutex
+	requests      int
+	responseBytes int64
+}
+
+// ErrBudgetExceeded is returned when a thread goes over its Budget.
+type ErrBudgetExceeded struct {
+	// Limit describes the limit that was exceeded, for example
+	// "HTTP requests".
+	Limit string
+	Max   int64
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	return fmt.Sprintf("exceeded limit of %d %s", e.Max, e.Limit)
+}
+
+// AttachBudget attaches a budget to a Starlark thread. Every request made by
+// the http module on the thread, and every response byte read, is counted
+// against it.
+func AttachBudget(thread *starlark.Thread, b *Budget) {
+	thread.SetLocal(threadBudgetKey, b)
+}
+
+func threadBudget(thread *starlark.Thread) *Budget {
+	if thread == nil {
+		return nil
+	}
+
+	b, _ := thread.Local(threadBudgetKey).(*Budget)
+	return b
+}
+
+// startRequest counts a request against the budget.
+func (b *Budget) startRequest() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.MaxRequests > 0 && b.requests >= b.MaxRequests {
+		return &ErrBudgetExceeded{Limit: "HTTP requests", Max: int64(b.MaxRequests)}
+	}
+
+	b.requests++
+	return nil
+}
+
+// readBytes counts n response bytes against the budget.
+func (b *Budget) readBytes(n int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.responseBytes += int64(n)
+	if b.MaxResponseBytes > 0 && b.responseBytes > b.MaxResponseBytes {
+		return &ErrBudgetExceeded{Limit: "HTTP response bytes", Max: b.MaxResponseBytes}
+	}
+
+	return nil
+}
+
+// budgetedBody counts the bytes read from a response body.
+type budgetedBody struct {
+	io.ReadCloser
+	budget *Budget
+}
+
+func (r *budgetedBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if budgetErr := r.budget.readBytes(n); budgetErr != nil {
+		return n, budgetErr
+	}
+
+	return n, err
+}
@@ -0,0 +1,26 @@
+package starlarkhttp
+
+import (
+	"net/http"
+
+	"go.starlark.net/starlark"
+)
+
+const threadClientKey = "tidbyt.dev/pixlet/runtime/modules/starlarkhttp/client"
+
+// AttachClient makes the http module send the requests made on a Starlark
+// thread with cli, instead of the client that the module was loaded with.
+// Budgets, timeouts, retries and observers still apply.
+func AttachClient(thread *starlark.Thread, cli *http.Client) {
+	thread.SetLocal(threadClientKey, cli)
+}
+
+// client returns the client to send requests made on thread with.
+func (m *Module) client(thread *starlark.Thread) *http.Client {
+	if thread != nil {
+		if cli, ok := thread.Local(threadClientKey).(*http.Client); ok {
+			return cli
+		}
+	}
+	return m.cli
+}
@@ -0,0 +1,234 @@
+package starlarkhttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.starlark.net/starlark"
+	"tidbyt.dev/pixlet/starlarkutil"
+)
+
+// NetworkGuard is a RequestGuard that keeps apps from reaching private
+// networks. It rejects requests to loopback, link-local, unspecified,
+// private (RFC 1918 and RFC 4193) and carrier-grade NAT (RFC 6598) addresses.
+//
+// Destinations are checked when a request is made, after resolving its host,
+// and again when connecting, so that a host that resolves to a different
+// address the second time around is still caught. Redirects are checked by
+// CheckRedirect. For the connection-time check to apply, requests must be
+// sent through the transport returned by Transport.
+type NetworkGuard struct {
+	// AllowHosts are always allowed, even if they resolve to a private
+	// address. Entries are host names, "*.example.com" wildcards, IP
+	// addresses or CIDR ranges.
+	AllowHosts []string
+
+	// DenyHosts are always rejected. Entries take the same form as
+	// AllowHosts, and take precedence over them.
+	DenyHosts []string
+
+	// Resolver is used to look up hosts, both when checking requests and when
+	// connecting. If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+}
+
+// ErrRequestBlocked is returned for requests rejected by a NetworkGuard.
+type ErrRequestBlocked struct {
+	Host   string
+	Reason string
+}
+
+func (e *ErrRequestBlocked) Error() string {
+	return fmt.Sprintf("request to %s blocked: %s", e.Host, e.Reason)
+}
+
+// Allowed implements RequestGuard.
+func (g *NetworkGuard) Allowed(thread *starlark.Thread, req *http.Request) (*http.Request, error) {
+	ctx := context.Background()
+	if thread != nil {
+		ctx = starlarkutil.ThreadContext(thread)
+	}
+
+	if err := g.checkHost(ctx, req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// CheckRedirect can be used as http.Client.CheckRedirect to apply the guard
+// to every redirect that is followed.
+func (g *NetworkGuard) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+
+	return g.checkHost(req.Context(), req.URL.Hostname())
+}
+
+// Transport returns an HTTP transport that checks the address of every
+// connection it opens. Proxies are not used, since they would hide the
+// actual destination.
+func (g *NetworkGuard) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = g.dialContext
+
+	return t
+}
+
+func (g *NetworkGuard) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Resolver:  g.Resolver,
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	// hosts that are explicitly allowed may resolve to private addresses,
+	// everything else is checked once the address is known
+	if !matchHostList(g.AllowHosts, host, nil) || matchHostList(g.DenyHosts, host, nil) {
+		dialer.Control = g.control
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+func (g *NetworkGuard) checkHost(ctx context.Context, host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if matchHostList(g.DenyHosts, host, nil) {
+		return &ErrRequestBlocked{Host: host, Reason: "host is denied"}
+	}
+
+	if matchHostList(g.AllowHosts, host, nil) {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return g.checkIP(host, ip)
+	}
+
+	resolver := g.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		// if the host can't be resolved, the request is let through, to fail
+		// or be served from cache. it's only protected by the check made
+		// when connecting, which also applies if the host resolves by then,
+		// so requests must be sent through Transport.
+		return nil
+	}
+
+	for _, addr := range addrs {
+		if err := g.checkIP(host, addr.IP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *NetworkGuard) checkIP(host string, ip net.IP) error {
+	if matchHostList(g.DenyHosts, "", ip) {
+		return &ErrRequestBlocked{Host: host, Reason: fmt.Sprintf("address %s is denied", ip)}
+	}
+
+	if matchHostList(g.AllowHosts, "", ip) {
+		return nil
+	}
+
+	if reason := disallowedIPReason(ip); reason != "" {
+		return &ErrRequestBlocked{Host: host, Reason: fmt.Sprintf("%s is %s address", ip, reason)}
+	}
+
+	return nil
+}
+
+// control is called by the dialer before connecting, with the resolved
+// address.
+func (g *NetworkGuard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("unexpected address: %s", address)
+	}
+
+	return g.checkIP(host, ip)
+}
+
+// carrierGradeNAT is the shared address space of RFC 6598, which isn't
+// covered by net.IP.IsPrivate.
+var carrierGradeNAT = &net.IPNet{
+	IP:   net.IPv4(100, 64, 0, 0),
+	Mask: net.CIDRMask(10, 32),
+}
+
+func disallowedIPReason(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return "a loopback"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return "a link-local"
+	case ip.IsPrivate():
+		return "a private"
+	case ip.IsUnspecified():
+		return "an unspecified"
+	case carrierGradeNAT.Contains(ip):
+		return "a carrier-grade NAT"
+	default:
+		return ""
+	}
+}
+
+// matchHostList reports whether host or ip matches an entry of list.
+func matchHostList(list []string, host string, ip net.IP) bool {
+	for _, entry := range list {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		if host == "" {
+			continue
+		}
+
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,219 @@
+package starlarkhttp_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+)
+
+func TestNetworkGuardAllowed(t *testing.T) {
+	g := &starlarkhttp.NetworkGuard{
+		AllowHosts: []string{"10.1.2.3", "192.168.0.0/24", "*.internal.example"},
+		DenyHosts:  []string{"evil.example.com", "8.8.8.8"},
+	}
+
+	for url, allowed := range map[string]bool{
+		"http://127.0.0.1/":                false,
+		"http://[::1]/":                    false,
+		"http://169.254.169.254/latest":    false,
+		"http://10.0.0.1/":                 false,
+		"http://172.16.5.4/":               false,
+		"http://192.168.1.1/":              false,
+		"http://[fd00::1]/":                false,
+		"http://0.0.0.0/":                  false,
+		"http://100.64.0.1/":               false,
+		"http://100.127.255.254/":          false,
+		"http://8.8.8.8/":                  false,
+		"http://evil.example.com/":         false,
+		"http://1.1.1.1/":                  true,
+		"http://100.128.0.1/":              true,
+		"http://10.1.2.3/":                 true,
+		"http://192.168.0.42/":             true,
+		"http://api.internal.example/":     true,
+		"http://api.internal.example.:80/": true,
+	} {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+
+		_, err = g.Allowed(nil, req)
+		if allowed {
+			assert.NoError(t, err, url)
+		} else {
+			var blocked *starlarkhttp.ErrRequestBlocked
+			assert.True(t, errors.As(err, &blocked), url)
+		}
+	}
+}
+
+func TestNetworkGuardTransport(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("custom dialers are not supported on js/wasm")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	// the guard checks the address that is actually dialed, regardless of
+	// the checks made before the request
+	g := &starlarkhttp.NetworkGuard{}
+	client := &http.Client{Transport: g.Transport()}
+
+	_, err := client.Get(ts.URL)
+	var blocked *starlarkhttp.ErrRequestBlocked
+	assert.True(t, errors.As(err, &blocked))
+
+	host, _, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.NoError(t, err)
+
+	g = &starlarkhttp.NetworkGuard{AllowHosts: []string{host}}
+	client = &http.Client{Transport: g.Transport()}
+
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestNetworkGuardRedirect(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("custom dialers are not supported on js/wasm")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	host, _, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.NoError(t, err)
+
+	g := &starlarkhttp.NetworkGuard{AllowHosts: []string{host}}
+	client := &http.Client{
+		Transport:     g.Transport(),
+		CheckRedirect: g.CheckRedirect,
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), "GET", ts.URL, nil)
+	require.NoError(t, err)
+
+	_, err = client.Do(req)
+	var blocked *starlarkhttp.ErrRequestBlocked
+	assert.True(t, errors.As(err, &blocked))
+}
+
+// fakeDNS is a resolver that answers every A query with 127.0.0.1, or fails
+// them while failing is set.
+type fakeDNS struct {
+	failing atomic.Bool
+}
+
+func (d *fakeDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go d.serve(server)
+			return client, nil
+		},
+	}
+}
+
+// serve answers queries over conn, which the resolver treats as a TCP
+// connection, with messages prefixed by their length.
+func (d *fakeDNS) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+
+		var query dnsmessage.Message
+		if err := query.Unpack(b); err != nil || len(query.Questions) == 0 {
+			return
+		}
+
+		reply := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:                 query.ID,
+				Response:           true,
+				Authoritative:      true,
+				RecursionAvailable: true,
+			},
+			Questions: query.Questions,
+		}
+
+		q := query.Questions[0]
+		if d.failing.Load() {
+			reply.RCode = dnsmessage.RCodeServerFailure
+		} else if q.Type == dnsmessage.TypeA {
+			reply.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			}}
+		}
+
+		out, err := reply.Pack()
+		if err != nil {
+			return
+		}
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(out))); err != nil {
+			return
+		}
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func TestNetworkGuardUnresolvedHost(t *testing.T) {
+	if runtime.GOOS == "js" {
+		t.Skip("custom dialers are not supported on js/wasm")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.NoError(t, err)
+	url := "http://rebind.example:" + port + "/"
+
+	dns := &fakeDNS{}
+	g := &starlarkhttp.NetworkGuard{Resolver: dns.resolver()}
+
+	// a host that can't be resolved gets past the request check
+	dns.failing.Store(true)
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	_, err = g.Allowed(nil, req)
+	require.NoError(t, err)
+
+	// but if it resolves to a private address by the time it connects, the
+	// connection is still blocked
+	dns.failing.Store(false)
+	client := &http.Client{Transport: g.Transport()}
+	_, err = client.Do(req)
+	var blocked *starlarkhttp.ErrRequestBlocked
+	assert.True(t, errors.As(err, &blocked), "%v", err)
+}
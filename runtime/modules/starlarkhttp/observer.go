@@ -0,0 +1,32 @@
+package starlarkhttp
+
+import (
+	"net/http"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const threadObserversKey = "tidbyt.dev/pixlet/runtime/modules/starlarkhttp/observers"
+
+// RequestObserver is called after every request made by the http module on
+// a thread, with the response or the error that the request failed with.
+type RequestObserver func(req *http.Request, res *http.Response, err error, duration time.Duration)
+
+// AttachRequestObserver adds an observer to a Starlark thread. Observers are
+// called in the order they were attached.
+func AttachRequestObserver(thread *starlark.Thread, obs RequestObserver) {
+	observers, _ := thread.Local(threadObserversKey).([]RequestObserver)
+	thread.SetLocal(threadObserversKey, append(observers, obs))
+}
+
+func notifyRequestObservers(thread *starlark.Thread, req *http.Request, res *http.Response, err error, duration time.Duration) {
+	if thread == nil {
+		return
+	}
+
+	observers, _ := thread.Local(threadObserversKey).([]RequestObserver)
+	for _, obs := range observers {
+		obs(req, res, err, duration)
+	}
+}
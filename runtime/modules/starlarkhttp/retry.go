@@ -0,0 +1,133 @@
+package starlarkhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxRetries is the most times a request can be retried.
+	MaxRetries = 5
+
+	// DefaultBackoff is the delay before the first retry of a request,
+	// unless another is given with backoff=. It doubles with every retry.
+	DefaultBackoff = 1 * time.Second
+
+	// MaxRetryDelay is the longest that a request waits before being
+	// retried. Responses that ask for a longer wait with Retry-After are
+	// returned instead.
+	MaxRetryDelay = 30 * time.Second
+)
+
+type attemptContextKey struct{}
+type timeoutContextKey struct{}
+
+// RequestAttempt returns the attempt of the request that ctx belongs to: 0
+// for the first attempt, 1 for the first retry and so on.
+func RequestAttempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptContextKey{}).(int)
+	return attempt
+}
+
+// RequestTimeout returns the timeout that the app set with timeout= for the
+// request that ctx belongs to, if it set one.
+func RequestTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(timeoutContextKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// retryDelay returns how long to wait before retrying a request that got res
+// or failed with err, on its given attempt, and whether it should be retried
+// at all. Server errors, 429s and failed connections are retried, unless ctx,
+// which the request was made with, is done. Requests that were blocked or went
+// over budget aren't.
+func retryDelay(ctx context.Context, res *http.Response, err error, backoff time.Duration, attempt int) (time.Duration, bool) {
+	if ctx.Err() != nil {
+		return 0, false
+	}
+
+	delay := backoff << attempt
+
+	switch {
+	case err != nil:
+		var (
+			blocked *ErrRequestBlocked
+			budget  *ErrBudgetExceeded
+		)
+		if errors.As(err, &blocked) || errors.As(err, &budget) {
+			return 0, false
+		}
+
+	case res.StatusCode == http.StatusTooManyRequests:
+		if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			delay = retryAfter
+		}
+
+	case res.StatusCode >= 500:
+
+	default:
+		return 0, false
+	}
+
+	if delay > MaxRetryDelay {
+		return 0, false
+	}
+
+	// don't wait for a retry that couldn't finish in time
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		delay := time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// cancelBody cancels the context of a request with a timeout once its
+// response has been read.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
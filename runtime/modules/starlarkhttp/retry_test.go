@@ -0,0 +1,178 @@
+package starlarkhttp_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qri-io/starlib/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+	"tidbyt.dev/pixlet/starlarkutil"
+)
+
+// runHTTP runs src on a thread with ctx, and returns its globals and the
+// attempt of each request it made.
+func runHTTP(ctx context.Context, src string) (starlark.StringDict, []int, error) {
+	thread := &starlark.Thread{Load: testdata.NewLoader(starlarkhttp.LoadModule, starlarkhttp.ModuleName)}
+	starlarkutil.AttachThreadContext(ctx, thread)
+
+	var attempts []int
+	starlarkhttp.AttachRequestObserver(thread, func(req *http.Request, res *http.Response, err error, duration time.Duration) {
+		attempts = append(attempts, starlarkhttp.RequestAttempt(req.Context()))
+	})
+
+	globals, err := starlark.ExecFile(thread, "test.star", src, nil)
+	return globals, attempts, err
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	globals, attempts, err := runHTTP(context.Background(), fmt.Sprintf(`
+load("http.star", "http")
+res = http.post("%s", body = "hello", retries = 2, backoff = 0.001)
+status = res.status_code
+body = res.body()
+`, ts.URL))
+	require.NoError(t, err)
+	assert.Equal(t, starlark.MakeInt(200), globals["status"])
+	assert.Equal(t, starlark.String("ok"), globals["body"])
+	assert.Equal(t, []int{0, 1, 2}, attempts)
+
+	// once retries run out, the last response is returned
+	hits.Store(0)
+	globals, attempts, err = runHTTP(context.Background(), fmt.Sprintf(`
+load("http.star", "http")
+status = http.get("%s", retries = 1, backoff = 0.001).status_code
+`, ts.URL))
+	require.NoError(t, err)
+	assert.Equal(t, starlark.MakeInt(503), globals["status"])
+	assert.Equal(t, []int{0, 1}, attempts)
+}
+
+func TestRetryResendsBody(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	_, _, err := runHTTP(context.Background(), fmt.Sprintf(`
+load("http.star", "http")
+http.post("%s", json_body = {"a": 1}, retries = 1, backoff = 0.001)
+`, ts.URL))
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"a":1}`, `{"a":1}`}, bodies)
+}
+
+func TestRetryTooManyRequests(t *testing.T) {
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch hits.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			// too long to wait for
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	globals, attempts, err := runHTTP(context.Background(), fmt.Sprintf(`
+load("http.star", "http")
+status = http.get("%s", retries = 3, backoff = 0.001).status_code
+`, ts.URL))
+	require.NoError(t, err)
+	assert.Equal(t, starlark.MakeInt(429), globals["status"])
+	assert.Equal(t, []int{0, 1}, attempts)
+}
+
+func TestRetryConnectionErrors(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	_, attempts, err := runHTTP(context.Background(), fmt.Sprintf(`
+load("http.star", "http")
+http.get("%s", retries = 2, backoff = 0.001)
+`, ts.URL))
+	assert.Error(t, err)
+	assert.Equal(t, []int{0, 1, 2}, attempts)
+}
+
+func TestNoRetryForClientErrors(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	globals, attempts, err := runHTTP(context.Background(), fmt.Sprintf(`
+load("http.star", "http")
+status = http.get("%s", retries = 2, backoff = 0.001).status_code
+`, ts.URL))
+	require.NoError(t, err)
+	assert.Equal(t, starlark.MakeInt(404), globals["status"])
+	assert.Equal(t, []int{0}, attempts)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	_, attempts, err := runHTTP(context.Background(), fmt.Sprintf(`
+load("http.star", "http")
+http.get("%s", timeout = 0.05, retries = 1, backoff = 0.001)
+`, ts.URL))
+	assert.ErrorContains(t, err, "deadline exceeded")
+	assert.Equal(t, []int{0, 1}, attempts)
+}
+
+func TestRequestUsesThreadContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the request isn't retried once the thread's context is done
+	_, attempts, err := runHTTP(ctx, fmt.Sprintf(`
+load("http.star", "http")
+http.get("%s", retries = 3)
+`, ts.URL))
+	assert.ErrorContains(t, err, "deadline exceeded")
+	assert.Equal(t, []int{0}, attempts)
+}
+
+func TestRetryArguments(t *testing.T) {
+	for src, msg := range map[string]string{
+		`http.get("http://example.com", retries = 6)`:      "retries must be between 0 and 5",
+		`http.get("http://example.com", retries = -1)`:     "retries must be between 0 and 5",
+		`http.get("http://example.com", timeout = -1)`:     "timeout must not be negative",
+		`http.get("http://example.com", backoff = "slow")`: "for parameter backoff: got string, want int or float",
+	} {
+		_, _, err := runHTTP(context.Background(), `load("http.star", "http")`+"\n"+src)
+		assert.ErrorContains(t, err, msg, src)
+	}
+}
@@ -27,6 +27,7 @@ package starlarkhttp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -35,10 +36,14 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	util "github.com/qri-io/starlib/util"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
+
+	"tidbyt.dev/pixlet/starlarkutil"
+	"tidbyt.dev/pixlet/tracing"
 )
 
 // AsString unquotes a starlark string value
@@ -122,9 +127,24 @@ func (m *Module) reqMethod(method string) func(thread *starlark.Thread, _ *starl
 			body         starlark.String
 			jsonBody     starlark.Value
 			ttl          starlark.Int
+			timeoutv     starlark.Value
+			retries      int
+			backoffv     starlark.Value
 		)
 
-		if err := starlark.UnpackArgs(method, args, kwargs, "url", &urlv, "params?", &params, "headers", &headers, "body", &body, "form_body", &formBody, "form_encoding", &formEncoding, "json_body", &jsonBody, "auth", &auth, "ttl_seconds?", &ttl); err != nil {
+		if err := starlark.UnpackArgs(method, args, kwargs, "url", &urlv, "params?", &params, "headers", &headers, "body", &body, "form_body", &formBody, "form_encoding", &formEncoding, "json_body", &jsonBody, "auth", &auth, "ttl_seconds?", &ttl, "timeout?", &timeoutv, "retries?", &retries, "backoff?", &backoffv); err != nil {
+			return nil, err
+		}
+
+		timeout, err := asSeconds(method, "timeout", timeoutv, 0)
+		if err != nil {
+			return nil, err
+		}
+		if retries < 0 || retries > MaxRetries {
+			return nil, fmt.Errorf("%s: retries must be between 0 and %d", method, MaxRetries)
+		}
+		backoff, err := asSeconds(method, "backoff", backoffv, DefaultBackoff)
+		if err != nil {
 			return nil, err
 		}
 
@@ -136,7 +156,8 @@ func (m *Module) reqMethod(method string) func(thread *starlark.Thread, _ *starl
 			return nil, err
 		}
 
-		req, err := http.NewRequest(strings.ToUpper(method), rawurl, nil)
+		ctx := threadContext(thread)
+		req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), rawurl, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -160,7 +181,37 @@ func (m *Module) reqMethod(method string) func(thread *starlark.Thread, _ *starl
 			return nil, err
 		}
 
-		res, err := m.cli.Do(req)
+		// the body is sent again with every retry
+		var reqBody []byte
+		if retries > 0 && req.Body != nil {
+			if reqBody, err = io.ReadAll(req.Body); err != nil {
+				return nil, err
+			}
+		}
+
+		var res *http.Response
+		for attempt := 0; ; attempt++ {
+			if reqBody != nil {
+				req.Body = io.NopCloser(bytes.NewReader(reqBody))
+			}
+
+			res, err = m.do(thread, req, attempt, timeout)
+			if attempt >= retries {
+				break
+			}
+
+			delay, retry := retryDelay(ctx, res, err, backoff, attempt)
+			if !retry {
+				break
+			}
+
+			if res != nil {
+				res.Body.Close()
+			}
+			if err := sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -170,6 +221,81 @@ func (m *Module) reqMethod(method string) func(thread *starlark.Thread, _ *starl
 	}
 }
 
+// do makes a single attempt at req, with a timeout if one is set.
+func (m *Module) do(thread *starlark.Thread, req *http.Request, attempt int, timeout time.Duration) (*http.Response, error) {
+	budget := threadBudget(thread)
+	if budget != nil {
+		if err := budget.startRequest(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.WithValue(req.Context(), attemptContextKey{}, attempt)
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx = context.WithValue(ctx, timeoutContextKey{}, timeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	req = req.WithContext(ctx)
+
+	span := tracing.FromContext(ctx).Start("http", req.Method+" "+req.URL.Host).
+		SetURL(req.URL).
+		SetAttr("method", req.Method)
+	if attempt > 0 {
+		span.SetAttr("attempt", attempt)
+	}
+
+	start := time.Now()
+	res, err := m.client(thread).Do(req)
+	notifyRequestObservers(thread, req, res, err, time.Since(start))
+	if err != nil {
+		cancel()
+		span.SetAttr("error", err.Error()).End()
+		return nil, err
+	}
+
+	span.SetAttr("status", res.StatusCode)
+	if status := res.Header.Get("tidbyt-cache-status"); status != "" {
+		span.SetAttr("cache_status", status)
+	}
+	span.End()
+
+	// the timeout covers reading the body too
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	if budget != nil {
+		res.Body = &budgetedBody{ReadCloser: res.Body, budget: budget}
+	}
+
+	return res, nil
+}
+
+// threadContext returns the context attached to thread, which requests are
+// made with, so that they're cancelled along with the thread.
+func threadContext(thread *starlark.Thread) context.Context {
+	if thread == nil {
+		return context.Background()
+	}
+	return starlarkutil.ThreadContext(thread)
+}
+
+// asSeconds converts v, a number of seconds passed to the named argument of
+// the method, to a duration. It returns def if v isn't set.
+func asSeconds(method, name string, v starlark.Value, def time.Duration) (time.Duration, error) {
+	if v == nil || v == starlark.None {
+		return def, nil
+	}
+
+	seconds, ok := starlark.AsFloat(v)
+	if !ok {
+		return 0, fmt.Errorf("%s: for parameter %s: got %s, want int or float", method, name, v.Type())
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf("%s: %s must not be negative", method, name)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
 func setQueryParams(rawurl *string, params *starlark.Dict) error {
 	keys := params.Keys()
 	if len(keys) == 0 {
@@ -9,6 +9,8 @@ import (
 	startime "go.starlark.net/lib/time"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
+
+	"tidbyt.dev/pixlet/starlarkutil"
 )
 
 const (
@@ -51,14 +53,14 @@ func sunrise(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple,
 		args, kwargs,
 		"lat", &starLat,
 		"lng", &starLng,
-		"date", &starDate,
+		"date?", &starDate,
 	); err != nil {
 		return nil, fmt.Errorf("unpacking arguments for sunrise: %s", err)
 	}
 
 	lat := float64(starLat)
 	lng := float64(starLng)
-	date := time.Time(starDate)
+	date := dateOrNow(thread, starDate)
 	rise, _ := gosunrise.SunriseSunset(lat, lng, date.Year(), date.Month(), date.Day())
 	if rise == empty {
 		return starlark.None, nil
@@ -79,14 +81,14 @@ func sunset(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, k
 		args, kwargs,
 		"lat", &starLat,
 		"lng", &starLng,
-		"date", &starDate,
+		"date?", &starDate,
 	); err != nil {
 		return nil, fmt.Errorf("unpacking arguments for sunset: %s", err)
 	}
 
 	lat := float64(starLat)
 	lng := float64(starLng)
-	date := time.Time(starDate)
+	date := dateOrNow(thread, starDate)
 	_, set := gosunrise.SunriseSunset(lat, lng, date.Year(), date.Month(), date.Day())
 	if set == empty {
 		return starlark.None, nil
@@ -107,14 +109,14 @@ func elevation(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple
 		args, kwargs,
 		"lat", &starLat,
 		"lng", &starLng,
-		"time", &starTime,
+		"time?", &starTime,
 	); err != nil {
 		return nil, fmt.Errorf("unpacking arguments for elevation: %s", err)
 	}
 
 	lat := float64(starLat)
 	lng := float64(starLng)
-	when := time.Time(starTime)
+	when := dateOrNow(thread, starTime)
 
 	elev := gosunrise.Elevation(lat, lng, when)
 	return starlark.Float(elev), nil
@@ -134,7 +136,7 @@ func elevation_time(thread *starlark.Thread, _ *starlark.Builtin, args starlark.
 		"lat", &starLat,
 		"lng", &starLng,
 		"elev", &starElev,
-		"date", &starDate,
+		"date?", &starDate,
 	); err != nil {
 		return nil, fmt.Errorf("unpacking arguments for elevation: %s", err)
 	}
@@ -142,7 +144,7 @@ func elevation_time(thread *starlark.Thread, _ *starlark.Builtin, args starlark.
 	lat := float64(starLat)
 	lng := float64(starLng)
 	elev := float64(starElev)
-	date := time.Time(starDate)
+	date := dateOrNow(thread, starDate)
 
 	morning, evening := gosunrise.TimeOfElevation(lat, lng, elev, date.Year(), date.Month(), date.Day())
 	if morning == empty || evening == empty {
@@ -153,3 +155,13 @@ func elevation_time(thread *starlark.Thread, _ *starlark.Builtin, args starlark.
 
 	return starlark.Tuple([]starlark.Value{starMorning, starEvening}), nil
 }
+
+// dateOrNow returns the given date, or the current time according to the
+// thread's clock if no date was passed.
+func dateOrNow(thread *starlark.Thread, starDate startime.Time) time.Time {
+	date := time.Time(starDate)
+	if date == empty {
+		return starlarkutil.ThreadNow(thread)
+	}
+	return date
+}
@@ -0,0 +1,133 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+func TestDefaultModules(t *testing.T) {
+	modules := DefaultModules.Modules()
+
+	var names []string
+	for _, m := range modules {
+		names = append(names, m.Name)
+		assert.NotEmpty(t, m.Description, m.Name)
+	}
+	assert.IsIncreasing(t, names)
+	assert.Contains(t, names, "render.star")
+	assert.Contains(t, names, "humanize.star")
+
+	http, ok := DefaultModules.Lookup("http.star")
+	require.True(t, ok)
+	assert.True(t, http.NeedsNetwork)
+	assert.False(t, http.Deterministic)
+
+	re, ok := DefaultModules.Lookup("re.star")
+	require.True(t, ok)
+	assert.False(t, re.NeedsNetwork)
+	assert.True(t, re.Deterministic)
+
+	assert.Error(t, DefaultModules.Register(http))
+}
+
+func TestModuleRegistry(t *testing.T) {
+	r := NewModuleRegistry()
+
+	assert.Error(t, r.Register(Module{Name: "nothing.star"}))
+
+	hello := Module{
+		Name: "hello.star",
+		Load: stringDictLoader(starlark.StringDict{"hello": starlark.String("hello")}),
+	}
+	require.NoError(t, r.Register(hello))
+	assert.Error(t, r.Register(hello))
+
+	clone := r.Clone()
+	clone.Remove("hello.star")
+
+	_, ok := clone.Lookup("hello.star")
+	assert.False(t, ok)
+	_, ok = r.Lookup("hello.star")
+	assert.True(t, ok)
+}
+
+func TestAppletModules(t *testing.T) {
+	greeting := Module{
+		Name:          "greeting.star",
+		Description:   "Greetings",
+		Deterministic: true,
+		Load: stringDictLoader(starlark.StringDict{
+			"greeting": &starlarkstruct.Module{
+				Name: "greeting",
+				Members: starlark.StringDict{
+					"text": starlark.String("hello"),
+				},
+			},
+		}),
+	}
+
+	src := `
+load("render.star", "render")
+load("greeting.star", "greeting")
+
+def main():
+    return render.Root(child=render.Text(greeting.text))
+`
+
+	// unknown modules can't be loaded
+	_, err := NewApplet("test.star", []byte(src))
+	assert.ErrorContains(t, err, "invalid module: greeting.star")
+
+	app, err := NewApplet("test.star", []byte(src), WithModule(greeting))
+	require.NoError(t, err)
+	roots, err := app.Run(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, roots, 1)
+
+	// adding a module to one applet doesn't add it to others
+	_, ok := DefaultModules.Lookup("greeting.star")
+	assert.False(t, ok)
+
+	// built-in modules can be removed or replaced
+	app, err = NewApplet("test.star", []byte(src), WithModule(greeting), WithoutModules("render.star"))
+	assert.ErrorContains(t, err, "invalid module: render.star")
+	assert.Nil(t, app)
+
+	app, err = NewApplet("test.star", []byte(`
+load("http.star", "http")
+def main():
+    return http.get("https://example.com")
+`), WithModule(Module{
+		Name: "http.star",
+		Load: stringDictLoader(starlark.StringDict{
+			"http": &starlarkstruct.Module{
+				Name: "http",
+				Members: starlark.StringDict{
+					"get": starlark.NewBuiltin("get", func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+						return starlark.String("offline"), nil
+					}),
+				},
+			},
+		}),
+	}))
+	require.NoError(t, err)
+	_, err = app.Run(context.Background())
+	assert.ErrorContains(t, err, "expected app implementation to return Root(s) but found: string")
+
+	// a registry can replace the defaults entirely
+	registry := NewModuleRegistry()
+	require.NoError(t, registry.Register(greeting))
+	app, err = NewApplet("test.star", []byte(`
+load("greeting.star", "greeting")
+def main():
+    return []
+`), WithModules(registry))
+	require.NoError(t, err)
+	require.Len(t, app.Modules(), 1)
+	assert.Equal(t, "greeting.star", app.Modules()[0].Name)
+}
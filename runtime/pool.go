@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	goruntime "runtime"
+	"sync"
+
+	"tidbyt.dev/pixlet/render"
+)
+
+// AppletPool renders one applet for many configurations in parallel.
+//
+// The applet is loaded once. Its module globals are frozen when loaded, so
+// every run shares them and only gets a thread of its own. At most
+// parallelism runs execute at the same time, across all callers of the pool.
+type AppletPool struct {
+	Applet *Applet
+
+	sem chan bool
+}
+
+// PoolResult is the outcome of running the applet with a single config.
+type PoolResult struct {
+	Config map[string]string
+	Roots  []render.Root
+	Err    error
+}
+
+// NewAppletPool loads an applet from fsys and creates a pool for it. If
+// parallelism is zero or negative, runtime.NumCPU() runs are allowed at the
+// same time.
+func NewAppletPool(id string, fsys fs.FS, parallelism int, opts ...AppletOption) (*AppletPool, error) {
+	app, err := NewAppletFromFS(id, fsys, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAppletPoolForApplet(app, parallelism), nil
+}
+
+// NewAppletPoolForApplet creates a pool for an applet that is already
+// loaded. The applet must not be modified while the pool is in use.
+func NewAppletPoolForApplet(app *Applet, parallelism int) *AppletPool {
+	if parallelism <= 0 {
+		parallelism = goruntime.NumCPU()
+	}
+
+	return &AppletPool{
+		Applet: app,
+		sem:    make(chan bool, parallelism),
+	}
+}
+
+// RunWithConfig runs the applet with config once a slot in the pool is
+// free. It is safe to call from multiple goroutines.
+func (p *AppletPool) RunWithConfig(ctx context.Context, config map[string]string) ([]render.Root, error) {
+	select {
+	case p.sem <- true:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting to run %s: %w", p.Applet.ID, context.Cause(ctx))
+	}
+	defer func() { <-p.sem }()
+
+	return p.Applet.RunWithConfig(ctx, config)
+}
+
+// RunConfigs runs the applet once for each config, in parallel, and returns
+// the results in the same order as configs. A failure for one config doesn't
+// stop the others from running.
+func (p *AppletPool) RunConfigs(ctx context.Context, configs []map[string]string) []PoolResult {
+	results := make([]PoolResult, len(configs))
+
+	var wg sync.WaitGroup
+	for i, config := range configs {
+		wg.Add(1)
+
+		go func(i int, config map[string]string) {
+			defer wg.Done()
+
+			roots, err := p.RunWithConfig(ctx, config)
+			results[i] = PoolResult{
+				Config: config,
+				Roots:  roots,
+				Err:    err,
+			}
+		}(i, config)
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,192 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"tidbyt.dev/pixlet/render"
+)
+
+var poolTestSrc = `
+load("render.star", "render")
+
+GREETINGS = {"en": "hello", "fr": "bonjour"}
+
+def main(config):
+    lang = config.get("lang", "en")
+    if lang not in GREETINGS:
+        fail("unknown language", lang)
+    return render.Root(child=render.Text(GREETINGS[lang] + " " + config.get("name", "")))
+`
+
+func TestAppletPoolRunConfigs(t *testing.T) {
+	fsys := fstest.MapFS{"pool.star": {Data: []byte(poolTestSrc)}}
+
+	pool, err := NewAppletPool("pool", fsys, 4)
+	require.NoError(t, err)
+
+	configs := []map[string]string{}
+	for i := 0; i < 100; i++ {
+		lang := "en"
+		if i%2 == 1 {
+			lang = "fr"
+		}
+		configs = append(configs, map[string]string{"lang": lang, "name": fmt.Sprint(i)})
+	}
+	configs = append(configs, map[string]string{"lang": "de"})
+
+	results := pool.RunConfigs(context.Background(), configs)
+	require.Len(t, results, len(configs))
+
+	for i, res := range results[:100] {
+		require.NoError(t, res.Err)
+		assert.Equal(t, configs[i], res.Config)
+		require.Len(t, res.Roots, 1)
+
+		text, ok := res.Roots[0].Child.(*render.Text)
+		require.True(t, ok)
+		assert.Equal(t, fmt.Sprintf("%s %d", map[int]string{0: "hello", 1: "bonjour"}[i%2], i), text.Content)
+	}
+
+	assert.ErrorContains(t, results[100].Err, "unknown language")
+	assert.Nil(t, results[100].Roots)
+}
+
+func TestAppletPoolParallelism(t *testing.T) {
+	var (
+		mutex  sync.Mutex
+		active int
+		peak   int
+	)
+
+	work := starlark.NewBuiltin("work", func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+		mutex.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		active--
+		mutex.Unlock()
+
+		return starlark.None, nil
+	})
+
+	loader := func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+		if module != "work.star" {
+			return nil, fmt.Errorf("invalid module: %s", module)
+		}
+		return starlark.StringDict{
+			"work": &starlarkstruct.Module{Name: "work", Members: starlark.StringDict{"work": work}},
+		}, nil
+	}
+
+	src := `
+load("render.star", "render")
+load("work.star", "work")
+
+def main():
+    work.work()
+    return render.Root(child=render.Box())
+`
+	fsys := fstest.MapFS{"app.star": {Data: []byte(src)}}
+
+	pool, err := NewAppletPool("work", fsys, 3, WithModuleLoader(loader))
+	require.NoError(t, err)
+
+	results := pool.RunConfigs(context.Background(), make([]map[string]string, 20))
+	for _, res := range results {
+		assert.NoError(t, res.Err)
+	}
+
+	assert.LessOrEqual(t, peak, 3)
+	assert.Greater(t, peak, 1)
+}
+
+func TestAppletPoolCancelled(t *testing.T) {
+	app, err := NewApplet("pool", []byte(poolTestSrc))
+	require.NoError(t, err)
+	pool := NewAppletPoolForApplet(app, 1)
+
+	// occupy the only slot
+	pool.sem <- true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = pool.RunWithConfig(ctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+var poolBenchmarkSrc = `
+load("render.star", "render")
+
+def main(config):
+    n = int(config.get("n", "0"))
+    total = 0
+    for i in range(20000):
+        total += (i * n) % 7
+    return render.Root(child=render.Text(str(total)))
+`
+
+func poolBenchmarkConfigs(n int) []map[string]string {
+	configs := make([]map[string]string, n)
+	for i := range configs {
+		configs[i] = map[string]string{"n": fmt.Sprint(i)}
+	}
+	return configs
+}
+
+// BenchmarkAppletSequential renders a batch of configs one after the other,
+// as the loader used to do, for comparison with BenchmarkAppletPool.
+func BenchmarkAppletSequential(b *testing.B) {
+	app, err := NewApplet("bench", []byte(poolBenchmarkSrc))
+	require.NoError(b, err)
+	configs := poolBenchmarkConfigs(100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, config := range configs {
+			if _, err := app.RunWithConfig(context.Background(), config); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.ReportMetric(float64(b.N*len(configs))/b.Elapsed().Seconds(), "renders/s")
+}
+
+func BenchmarkAppletPool(b *testing.B) {
+	for _, parallelism := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism=%d", parallelism), func(b *testing.B) {
+			app, err := NewApplet("bench", []byte(poolBenchmarkSrc))
+			require.NoError(b, err)
+			pool := NewAppletPoolForApplet(app, parallelism)
+			configs := poolBenchmarkConfigs(100)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, res := range pool.RunConfigs(context.Background(), configs) {
+					if res.Err != nil {
+						b.Fatal(res.Err)
+					}
+				}
+			}
+
+			b.ReportMetric(float64(b.N*len(configs))/b.Elapsed().Seconds(), "renders/s")
+		})
+	}
+}
@@ -0,0 +1,459 @@
+package runtime
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	// DefaultRedisPoolSize is the default number of idle connections kept
+	// open by a RedisCache.
+	DefaultRedisPoolSize = 8
+
+	redisDialTimeout = 1 * time.Second
+	redisIOTimeout   = 1 * time.Second
+
+	// redisRetryInterval is how long a RedisCache waits after failing to
+	// reach the server before trying again. In the meantime, all operations
+	// fail fast so that renders aren't slowed down by an unreachable cache.
+	redisRetryInterval = 5 * time.Second
+)
+
+// ErrRedisUnavailable is returned by RedisCache operations while the server
+// is considered unreachable.
+var ErrRedisUnavailable = errors.New("redis server unavailable")
+
+// RedisCache is a Cache backed by a server that speaks the Redis RESP
+// protocol. Connections are pooled and shared between goroutines.
+//
+// If the server can't be reached, operations return an error rather than
+// blocking, and the server isn't contacted again for a short while. Callers
+// such as cache.star and the HTTP cache already treat cache errors as misses.
+type RedisCache struct {
+	addr     string
+	password string
+	db       int
+
+	pool chan *redisConn
+
+	mutex     sync.Mutex
+	downUntil time.Time
+}
+
+// NewRedisCache creates a RedisCache from a URL of the form
+// redis://[:password@]host[:port][/db].
+func NewRedisCache(rawURL string) (*RedisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis URL: %w", err)
+	}
+
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported redis URL scheme: %s", u.Scheme)
+	}
+
+	c := &RedisCache{
+		addr: u.Host,
+		pool: make(chan *redisConn, DefaultRedisPoolSize),
+	}
+
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	if u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			c.password = p
+		} else {
+			c.password = u.User.Username()
+		}
+	}
+
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database: %s", db)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *RedisCache) Get(_ *starlark.Thread, key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if reply == nil {
+		return nil, false, nil
+	}
+
+	b, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+
+	return b, true, nil
+}
+
+func (c *RedisCache) Set(_ *starlark.Thread, key string, value []byte, ttl int64) error {
+	_, err := c.do("SET", key, value, "EX", redisTTL(ttl))
+	return err
+}
+
+func (c *RedisCache) Delete(_ *starlark.Thread, key string) error {
+	_, err := c.do("DEL", key)
+	return err
+}
+
+func (c *RedisCache) TTL(_ *starlark.Thread, key string) (int64, bool, error) {
+	reply, err := c.do("PTTL", key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	ms, ok := reply.(int64)
+	if !ok {
+		return 0, false, fmt.Errorf("unexpected reply to PTTL: %v", reply)
+	}
+
+	switch {
+	case ms == -2:
+		// key does not exist
+		return 0, false, nil
+	case ms < 0:
+		// key exists but never expires
+		return -1, true, nil
+	default:
+		return ceilSeconds(time.Duration(ms) * time.Millisecond), true, nil
+	}
+}
+
+func (c *RedisCache) Incr(_ *starlark.Thread, key string, delta int64, ttl int64) (int64, error) {
+	// creating the record with its TTL, if it doesn't exist, and then
+	// incrementing it in a transaction means that it can't be left without
+	// a TTL, nor have its TTL reset
+	replies, err := c.transaction(
+		[]interface{}{"SET", key, "0", "EX", redisTTL(ttl), "NX"},
+		[]interface{}{"INCRBY", key, delta},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	switch reply := replies[1].(type) {
+	case int64:
+		return reply, nil
+	case redisError:
+		if strings.Contains(string(reply), "not an integer") {
+			return 0, ErrCacheValueNotInteger
+		}
+		return 0, reply
+	default:
+		return 0, fmt.Errorf("unexpected reply to INCRBY: %v", reply)
+	}
+}
+
+// redisTTL returns the expiration in seconds for a record set with ttl.
+// Records without a TTL get the default one, so that they don't live
+// forever.
+func redisTTL(ttl int64) int64 {
+	if ttl <= 0 {
+		return DefaultExpirationSeconds
+	}
+	return ttl
+}
+
+// Close closes all idle connections.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case conn := <-c.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a single command to the server and returns its reply.
+func (c *RedisCache) do(args ...interface{}) (interface{}, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(args...)
+	if err != nil {
+		var redisErr redisError
+		if errors.As(err, &redisErr) {
+			// the server rejected the command, but the connection is fine
+			c.release(conn)
+		} else {
+			conn.Close()
+		}
+		return nil, err
+	}
+
+	c.release(conn)
+	return reply, nil
+}
+
+// transaction runs cmds atomically in a MULTI block, and returns their
+// replies. Commands that fail have a redisError as their reply.
+func (c *RedisCache) transaction(cmds ...[]interface{}) ([]interface{}, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.transaction(cmds...)
+	if err != nil {
+		var redisErr redisError
+		if errors.As(err, &redisErr) {
+			// the transaction was aborted, but the connection is fine
+			c.release(conn)
+		} else {
+			conn.Close()
+		}
+		return nil, err
+	}
+
+	c.release(conn)
+	return replies, nil
+}
+
+func (c *RedisCache) conn() (*redisConn, error) {
+	select {
+	case conn := <-c.pool:
+		return conn, nil
+	default:
+	}
+
+	c.mutex.Lock()
+	down := time.Now().Before(c.downUntil)
+	c.mutex.Unlock()
+
+	if down {
+		return nil, ErrRedisUnavailable
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		c.mutex.Lock()
+		c.downUntil = time.Now().Add(redisRetryInterval)
+		c.mutex.Unlock()
+
+		return nil, fmt.Errorf("%w: %v", ErrRedisUnavailable, err)
+	}
+
+	return conn, nil
+}
+
+func (c *RedisCache) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", c.addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{
+		Conn: nc,
+		r:    bufio.NewReader(nc),
+	}
+
+	if c.password != "" {
+		if _, err := conn.do("AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	if c.db != 0 {
+		if _, err := conn.do("SELECT", c.db); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("selecting database: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *RedisCache) release(conn *redisConn) {
+	select {
+	case c.pool <- conn:
+	default:
+		// pool is full
+		conn.Close()
+	}
+}
+
+// redisError is an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (conn *redisConn) do(args ...interface{}) (interface{}, error) {
+	conn.SetDeadline(time.Now().Add(redisIOTimeout))
+
+	if _, err := conn.Write(encodeRESPCommand(args...)); err != nil {
+		return nil, err
+	}
+
+	return readRESP(conn.r)
+}
+
+func (conn *redisConn) transaction(cmds ...[]interface{}) ([]interface{}, error) {
+	conn.SetDeadline(time.Now().Add(redisIOTimeout))
+
+	// send the whole block at once, then read every reply, so that the
+	// connection stays in sync even if a command is rejected
+	b := encodeRESPCommand("MULTI")
+	for _, cmd := range cmds {
+		b = append(b, encodeRESPCommand(cmd...)...)
+	}
+	b = append(b, encodeRESPCommand("EXEC")...)
+
+	if _, err := conn.Write(b); err != nil {
+		return nil, err
+	}
+
+	var queueErr error
+	for i := 0; i < len(cmds)+1; i++ {
+		if _, err := readRESP(conn.r); err != nil {
+			var redisErr redisError
+			if !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if queueErr == nil {
+				queueErr = err
+			}
+		}
+	}
+
+	reply, err := readRESP(conn.r)
+	if err != nil {
+		if queueErr != nil {
+			return nil, queueErr
+		}
+		return nil, err
+	}
+
+	replies, ok := reply.([]interface{})
+	if !ok || len(replies) != len(cmds) {
+		return nil, fmt.Errorf("unexpected reply to EXEC: %v", reply)
+	}
+
+	return replies, nil
+}
+
+// encodeRESPCommand encodes a command as a RESP array of bulk strings.
+func encodeRESPCommand(args ...interface{}) []byte {
+	b := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+
+	for _, arg := range args {
+		var s []byte
+		switch v := arg.(type) {
+		case []byte:
+			s = v
+		case string:
+			s = []byte(v)
+		case int:
+			s = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			s = strconv.AppendInt(nil, v, 10)
+		default:
+			s = []byte(fmt.Sprint(v))
+		}
+
+		b = append(b, fmt.Sprintf("$%d\r\n", len(s))...)
+		b = append(b, s...)
+		b = append(b, "\r\n"...)
+	}
+
+	return b
+}
+
+// readRESP reads a single RESP value. Simple strings are returned as string,
+// bulk strings as []byte, integers as int64, arrays as []interface{} and nil
+// bulk strings or arrays as nil. Error replies are returned as redisError,
+// except within arrays, where they're kept as redisError elements.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed RESP line: %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, redisError(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed RESP bulk length: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed RESP array length: %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		vals := make([]interface{}, n)
+		for i := range vals {
+			vals[i], err = readRESP(r)
+			if err != nil {
+				var redisErr redisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				vals[i] = redisErr
+			}
+		}
+		return vals, nil
+
+	default:
+		return nil, fmt.Errorf("unknown RESP type: %q", line)
+	}
+}
@@ -0,0 +1,403 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is a minimal in-process server that speaks enough of the RESP
+// protocol to exercise RedisCache.
+type fakeRedis struct {
+	t        *testing.T
+	listener net.Listener
+	password string
+
+	mutex   sync.Mutex
+	records map[string]fakeRedisRecord
+}
+
+type fakeRedisRecord struct {
+	value      []byte
+	expiration time.Time
+}
+
+// newFakeRedis starts a fake Redis server, which requires clients to
+// authenticate if password is set.
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeRedis{
+		t:        t,
+		listener: l,
+		password: password,
+		records:  map[string]fakeRedisRecord{},
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeRedis) url() string {
+	return fmt.Sprintf("redis://%s", s.listener.Addr())
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+
+	// queue holds the commands of a MULTI block, until EXEC
+	var queue [][]interface{}
+
+	for {
+		req, err := readRESP(r)
+		if err != nil {
+			return
+		}
+
+		args, ok := req.([]interface{})
+		if !ok || len(args) == 0 {
+			fmt.Fprint(conn, "-ERR bad request\r\n")
+			continue
+		}
+
+		cmd := strings.ToUpper(string(args[0].([]byte)))
+		if cmd == "AUTH" {
+			if string(args[1].([]byte)) != s.password {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authenticated = true
+			fmt.Fprint(conn, "+OK\r\n")
+			continue
+		}
+
+		if !authenticated {
+			fmt.Fprint(conn, "-NOAUTH Authentication required\r\n")
+			continue
+		}
+
+		switch {
+		case cmd == "MULTI":
+			queue = [][]interface{}{}
+			fmt.Fprint(conn, "+OK\r\n")
+
+		case cmd == "EXEC":
+			// run the queued commands without letting others in between
+			s.mutex.Lock()
+			fmt.Fprintf(conn, "*%d\r\n", len(queue))
+			for _, q := range queue {
+				s.handle(conn, strings.ToUpper(string(q[0].([]byte))), q[1:])
+			}
+			s.mutex.Unlock()
+			queue = nil
+
+		case queue != nil:
+			queue = append(queue, args)
+			fmt.Fprint(conn, "+QUEUED\r\n")
+
+		default:
+			s.mutex.Lock()
+			s.handle(conn, cmd, args[1:])
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// handle runs a single command. The caller must hold s.mutex.
+func (s *fakeRedis) handle(conn net.Conn, cmd string, args []interface{}) {
+	switch cmd {
+	case "PING":
+		fmt.Fprint(conn, "+PONG\r\n")
+
+	case "SELECT":
+		fmt.Fprint(conn, "+OK\r\n")
+
+	case "GET":
+		rec, ok := s.records[string(args[0].([]byte))]
+		if !ok || (!rec.expiration.IsZero() && time.Now().After(rec.expiration)) {
+			fmt.Fprint(conn, "$-1\r\n")
+			return
+		}
+		fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(rec.value), rec.value)
+
+	case "SET":
+		key := string(args[0].([]byte))
+		rec := fakeRedisRecord{value: args[1].([]byte)}
+		nx := false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(string(args[i].([]byte))) {
+			case "EX":
+				i++
+				ttl, _ := strconv.Atoi(string(args[i].([]byte)))
+				rec.expiration = time.Now().Add(time.Duration(ttl) * time.Second)
+			case "NX":
+				nx = true
+			}
+		}
+		if old, ok := s.records[key]; nx && ok && (old.expiration.IsZero() || time.Now().Before(old.expiration)) {
+			fmt.Fprint(conn, "$-1\r\n")
+			return
+		}
+		s.records[key] = rec
+		fmt.Fprint(conn, "+OK\r\n")
+
+	case "DEL":
+		delete(s.records, string(args[0].([]byte)))
+		fmt.Fprint(conn, ":1\r\n")
+
+	case "PTTL":
+		rec, ok := s.records[string(args[0].([]byte))]
+		switch {
+		case !ok || (!rec.expiration.IsZero() && time.Now().After(rec.expiration)):
+			fmt.Fprint(conn, ":-2\r\n")
+		case rec.expiration.IsZero():
+			fmt.Fprint(conn, ":-1\r\n")
+		default:
+			fmt.Fprintf(conn, ":%d\r\n", time.Until(rec.expiration).Milliseconds())
+		}
+
+	case "INCRBY":
+		key := string(args[0].([]byte))
+		delta, _ := strconv.ParseInt(string(args[1].([]byte)), 10, 64)
+		rec, ok := s.records[key]
+		if !ok || (!rec.expiration.IsZero() && time.Now().After(rec.expiration)) {
+			rec = fakeRedisRecord{value: []byte("0")}
+		}
+		n, err := strconv.ParseInt(string(rec.value), 10, 64)
+		if err != nil {
+			fmt.Fprint(conn, "-ERR value is not an integer or out of range\r\n")
+			return
+		}
+		rec.value = []byte(strconv.FormatInt(n+delta, 10))
+		s.records[key] = rec
+		fmt.Fprintf(conn, ":%d\r\n", n+delta)
+
+	case "EXPIRE":
+		key := string(args[0].([]byte))
+		ttl, _ := strconv.Atoi(string(args[1].([]byte)))
+		rec := s.records[key]
+		rec.expiration = time.Now().Add(time.Duration(ttl) * time.Second)
+		s.records[key] = rec
+		fmt.Fprint(conn, ":1\r\n")
+
+	default:
+		fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+func TestRedisCacheGetAndSet(t *testing.T) {
+	s := newFakeRedis(t, "")
+
+	c, err := NewRedisCache(s.url())
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, found, err := c.Get(nil, "foo")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar\r\nbaz"), 60))
+
+	val, found, err := c.Get(nil, "foo")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("bar\r\nbaz"), val)
+}
+
+func TestRedisCacheDeleteTTLAndIncr(t *testing.T) {
+	s := newFakeRedis(t, "")
+
+	c, err := NewRedisCache(s.url())
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), 60))
+
+	ttl, found, err := c.TTL(nil, "foo")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(60), ttl)
+
+	assert.NoError(t, c.Delete(nil, "foo"))
+	_, found, err = c.TTL(nil, "foo")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	n, err := c.Incr(nil, "counter", 2, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = c.Incr(nil, "counter", 3, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	ttl, _, _ = c.TTL(nil, "counter")
+	assert.Equal(t, int64(30), ttl)
+
+	// a counter that's back at its initial value keeps its TTL too
+	n, err = c.Incr(nil, "counter", -5, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = c.Incr(nil, "counter", 0, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	ttl, _, _ = c.TTL(nil, "counter")
+	assert.Equal(t, int64(30), ttl)
+
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), 60))
+	_, err = c.Incr(nil, "foo", 1, 60)
+	assert.ErrorIs(t, err, ErrCacheValueNotInteger)
+}
+
+func TestRedisCacheDefaultTTL(t *testing.T) {
+	s := newFakeRedis(t, "")
+
+	c, err := NewRedisCache(s.url())
+	require.NoError(t, err)
+	defer c.Close()
+
+	// records set without a TTL still expire
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), 0))
+	ttl, found, err := c.TTL(nil, "foo")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(DefaultExpirationSeconds), ttl)
+
+	_, err = c.Incr(nil, "counter", 1, 0)
+	assert.NoError(t, err)
+	ttl, _, _ = c.TTL(nil, "counter")
+	assert.Equal(t, int64(DefaultExpirationSeconds), ttl)
+}
+
+func TestRedisCacheIncrConcurrent(t *testing.T) {
+	s := newFakeRedis(t, "")
+
+	c, err := NewRedisCache(s.url())
+	require.NoError(t, err)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Incr(nil, "counter", 1, 30)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	val, _, err := c.Get(nil, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "20", string(val))
+
+	// whichever call created the counter gave it a TTL
+	ttl, _, _ := c.TTL(nil, "counter")
+	assert.Equal(t, int64(30), ttl)
+}
+
+func TestRedisCacheAuth(t *testing.T) {
+	s := newFakeRedis(t, "hunter2")
+
+	c, err := NewRedisCache(fmt.Sprintf("redis://:hunter2@%s/1", s.listener.Addr()))
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.db)
+	assert.NoError(t, c.Set(nil, "foo", []byte("bar"), 60))
+
+	c, err = NewRedisCache(fmt.Sprintf("redis://:wrong@%s", s.listener.Addr()))
+	require.NoError(t, err)
+	assert.Error(t, c.Set(nil, "foo", []byte("bar"), 60))
+}
+
+func TestRedisCacheConcurrent(t *testing.T) {
+	s := newFakeRedis(t, "")
+
+	c, err := NewRedisCache(s.url())
+	require.NoError(t, err)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i)
+			assert.NoError(t, c.Set(nil, key, []byte(key), 60))
+
+			val, found, err := c.Get(nil, key)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, key, string(val))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, len(c.pool), DefaultRedisPoolSize)
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	s := newFakeRedis(t, "")
+	addr := s.listener.Addr().String()
+	s.listener.Close()
+
+	c, err := NewRedisCache("redis://" + addr)
+	require.NoError(t, err)
+
+	_, found, err := c.Get(nil, "foo")
+	assert.ErrorIs(t, err, ErrRedisUnavailable)
+	assert.False(t, found)
+
+	// subsequent calls fail fast without dialing again
+	assert.ErrorIs(t, c.Set(nil, "foo", []byte("bar"), 60), ErrRedisUnavailable)
+}
+
+func TestRedisCacheWithApplet(t *testing.T) {
+	src := `
+load("render.star", "render")
+load("cache.star", "cache")
+
+def main():
+    i = int(cache.get("counter") or '1')
+    cache.set("counter", str(i + 1))
+    return [render.Root(child=render.Box()) for _ in range(i)]
+`
+	s := newFakeRedis(t, "")
+
+	c, err := NewRedisCache(s.url())
+	require.NoError(t, err)
+	defer c.Close()
+	InitCache(c)
+
+	app, err := NewApplet("test.star", []byte(src))
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		roots, err := app.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, i, len(roots))
+	}
+}
@@ -0,0 +1,134 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+
+	"tidbyt.dev/pixlet/starlarkutil"
+)
+
+// REPL evaluates Starlark code interactively, one statement at a time. It
+// uses the same modules and thread initializers as applets, e.g. for cache,
+// HTTP and secrets, and keeps globals between statements.
+type REPL struct {
+	Globals starlark.StringDict
+
+	applet *Applet
+}
+
+// NewREPL returns a REPL for the applet in fsys, whose main file's globals
+// are available in the REPL. If fsys is nil, the REPL starts out empty.
+func NewREPL(id string, fsys fs.FS, opts ...AppletOption) (*REPL, error) {
+	var (
+		a   *Applet
+		err error
+	)
+	if fsys != nil {
+		a, err = NewAppletFromFS(id, fsys, opts...)
+	} else {
+		a, err = newApplet(id, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	globals := starlark.StringDict{
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	}
+	for name, value := range a.globals[a.mainFile] {
+		globals[name] = value
+	}
+
+	return &REPL{
+		Globals: globals,
+		applet:  a,
+	}, nil
+}
+
+// Parse reads a statement from readLine, which returns a line of input,
+// including its newline, at a time. Compound statements, like function
+// definitions, are read up to a blank line. It returns io.EOF once readLine
+// has no more input.
+func (r *REPL) Parse(readLine func() ([]byte, error)) (*syntax.File, error) {
+	eof := false
+	f, err := r.fileOptions().ParseCompoundStmt("<stdin>", func() ([]byte, error) {
+		line, err := readLine()
+		if errors.Is(err, io.EOF) {
+			eof = true
+		}
+		return line, err
+	})
+	if err != nil {
+		if eof {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Exec runs a statement returned by Parse. If it's an expression, its value
+// is returned, and None otherwise.
+func (r *REPL) Exec(ctx context.Context, f *syntax.File) (val starlark.Value, err error) {
+	a := r.applet
+
+	t := a.newThread(ctx)
+	defer starlarkutil.RunOnExitFuncs(t)
+
+	// the applet's own files can be loaded too
+	t.Load = func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		if g, ok := a.globals[path.Clean(module)]; ok {
+			return g, nil
+		}
+		return a.loadModule(thread, module)
+	}
+
+	context.AfterFunc(ctx, func() {
+		t.Cancel(context.Cause(ctx).Error())
+	})
+
+	val = starlark.None
+	if expr := soleExpr(f); expr != nil {
+		val, err = starlark.EvalExprOptions(f.Options, t, expr, r.Globals)
+	} else {
+		err = starlark.ExecREPLChunk(f, t, r.Globals)
+	}
+
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			err = errors.New(evalErr.Backtrace())
+		}
+		return nil, errors.New(a.redactor.redact(err.Error()))
+	}
+
+	return val, nil
+}
+
+func (r *REPL) fileOptions() *syntax.FileOptions {
+	return &syntax.FileOptions{
+		Set:       true,
+		Recursion: true,
+
+		// load() binds globals, so that loaded values can be used in later
+		// statements
+		LoadBindsGlobally: true,
+	}
+}
+
+func soleExpr(f *syntax.File) syntax.Expr {
+	if len(f.Stmts) == 1 {
+		if stmt, ok := f.Stmts[0].(*syntax.ExprStmt); ok {
+			return stmt.X
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+
+	"tidbyt.dev/pixlet/runtime/modules/render_runtime"
+)
+
+// replInput returns a readLine function for REPL.Parse that reads lines.
+func replInput(lines ...string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if len(lines) == 0 {
+			return nil, io.EOF
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return []byte(line + "\n"), nil
+	}
+}
+
+func replEval(t *testing.T, repl *REPL, readLine func() ([]byte, error)) (starlark.Value, error) {
+	f, err := repl.Parse(readLine)
+	require.NoError(t, err)
+	return repl.Exec(context.Background(), f)
+}
+
+func TestREPL(t *testing.T) {
+	repl, err := NewREPL("repl", nil)
+	require.NoError(t, err)
+
+	readLine := replInput(
+		`load("render.star", "render")`,
+		`x = 21`,
+		`def double(n):`,
+		`    return n * 2`,
+		``,
+		`double(x)`,
+		`render.Box(width = 2, height = 2)`,
+		`fail("oh no")`,
+	)
+
+	for i := 0; i < 3; i++ {
+		val, err := replEval(t, repl, readLine)
+		require.NoError(t, err)
+		assert.Equal(t, starlark.None, val)
+	}
+
+	val, err := replEval(t, repl, readLine)
+	require.NoError(t, err)
+	assert.Equal(t, starlark.MakeInt(42), val)
+
+	val, err = replEval(t, repl, readLine)
+	require.NoError(t, err)
+	assert.Implements(t, (*render_runtime.Widget)(nil), val)
+
+	_, err = replEval(t, repl, readLine)
+	assert.ErrorContains(t, err, "oh no")
+
+	_, err = repl.Parse(readLine)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestREPLWithApp(t *testing.T) {
+	repl, err := NewREPL("app", fstest.MapFS{
+		"app.star": {Data: []byte(`
+load("lib.star", "GREETING")
+
+NAME = "world"
+
+def main():
+    return []
+`)},
+		"lib.star": {Data: []byte(`GREETING = "hello"`)},
+	})
+	require.NoError(t, err)
+
+	val, err := replEval(t, repl, replInput(`NAME`))
+	require.NoError(t, err)
+	assert.Equal(t, starlark.String("world"), val)
+
+	// files of the app can be loaded, and the modules it can use
+	_, err = replEval(t, repl, replInput(`load("lib.star", "GREETING")`))
+	require.NoError(t, err)
+	val, err = replEval(t, repl, replInput(`GREETING + " " + NAME`))
+	require.NoError(t, err)
+	assert.Equal(t, starlark.String("hello world"), val)
+
+	_, err = replEval(t, repl, replInput(`load("nope.star", "x")`))
+	assert.ErrorContains(t, err, "invalid module: nope.star")
+}
@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"tidbyt.dev/pixlet/render"
+	"tidbyt.dev/pixlet/runtime/modules/starlarkhttp"
+)
+
+const threadRunRecorderKey = "tidbyt.dev/pixlet/runtime/runrecorder"
+
+// RunResult describes a single run of an applet: the roots it returned, and
+// what it did along the way.
+type RunResult struct {
+	Roots []render.Root `json:"-"`
+
+	HTTPRequests    []HTTPRequestRecord    `json:"http_requests"`
+	CacheOperations []CacheOperationRecord `json:"cache_operations"`
+	Prints          []string               `json:"prints"`
+
+	// LoadDuration is how long it took to load the applet, which happens
+	// once when it's created.
+	LoadDuration time.Duration `json:"load_duration_ns"`
+
+	// ExecutionDuration is how long it took to run main().
+	ExecutionDuration time.Duration `json:"execution_duration_ns"`
+}
+
+// HTTPRequestRecord is an HTTP request made by an applet.
+type HTTPRequestRecord struct {
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+
+	// CacheStatus is HIT, MISS, REVALIDATED or STALE for requests that
+	// went through the HTTP cache, and empty otherwise.
+	CacheStatus string        `json:"cache_status,omitempty"`
+	Duration    time.Duration `json:"duration_ns"`
+	Error       string        `json:"error,omitempty"`
+
+	// Attempt is 0 for the first attempt at a request, and counts the
+	// retries made with retries= after that.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// CacheOperationRecord is a call to cache.star made by an applet.
+type CacheOperationRecord struct {
+	// Operation is one of get, set, delete or incr.
+	Operation string `json:"operation"`
+
+	// Key is the key as given by the applet.
+	Key string `json:"key"`
+
+	// Hit reports whether a get found a record.
+	Hit bool `json:"hit,omitempty"`
+
+	// TTL is the TTL of a set or incr, in seconds.
+	TTL int64 `json:"ttl_seconds,omitempty"`
+}
+
+// RunWithResult runs the applet's main function like RunWithConfig, and
+// records what happens during the run. The result is returned even if the
+// run fails, so that callers can see what led up to the failure.
+func (a *Applet) RunWithResult(ctx context.Context, config map[string]string) (*RunResult, error) {
+	rec := &runRecorder{
+		httpRequests:    []HTTPRequestRecord{},
+		cacheOperations: []CacheOperationRecord{},
+		prints:          []string{},
+	}
+	ctx = context.WithValue(ctx, runRecorderContextKey{}, rec)
+
+	start := time.Now()
+	roots, err := a.RunWithConfig(ctx, config)
+
+	result := &RunResult{
+		Roots:             roots,
+		LoadDuration:      a.loadDuration,
+		ExecutionDuration: time.Since(start),
+	}
+	rec.fill(result)
+
+	for i, r := range result.HTTPRequests {
+		result.HTTPRequests[i].URL = a.redactor.redact(r.URL)
+		result.HTTPRequests[i].Error = a.redactor.redact(r.Error)
+	}
+
+	return result, err
+}
+
+type runRecorderContextKey struct{}
+
+// runRecorder collects what happens on the threads of a single run.
+type runRecorder struct {
+	mutex           sync.Mutex
+	httpRequests    []HTTPRequestRecord
+	cacheOperations []CacheOperationRecord
+	prints          []string
+}
+
+// attachRunRecorder attaches the recorder found in ctx, if any, to thread. It
+// must be called after the thread's print function is set.
+func attachRunRecorder(ctx context.Context, thread *starlark.Thread) {
+	rec, ok := ctx.Value(runRecorderContextKey{}).(*runRecorder)
+	if !ok {
+		return
+	}
+
+	thread.SetLocal(threadRunRecorderKey, rec)
+
+	print := thread.Print
+	thread.Print = func(thread *starlark.Thread, msg string) {
+		rec.mutex.Lock()
+		rec.prints = append(rec.prints, msg)
+		rec.mutex.Unlock()
+
+		if print != nil {
+			print(thread, msg)
+		}
+	}
+
+	starlarkhttp.AttachRequestObserver(thread, rec.observeRequest)
+}
+
+func (rec *runRecorder) observeRequest(req *http.Request, res *http.Response, err error, duration time.Duration) {
+	r := HTTPRequestRecord{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Duration: duration,
+		Attempt:  starlarkhttp.RequestAttempt(req.Context()),
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.StatusCode = res.StatusCode
+		r.CacheStatus = res.Header.Get(CacheStatusHeader)
+	}
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.httpRequests = append(rec.httpRequests, r)
+}
+
+// recordCacheOperation records a cache.star call made on thread, if the
+// thread belongs to a run that is being recorded.
+func recordCacheOperation(thread *starlark.Thread, op CacheOperationRecord) {
+	rec, ok := thread.Local(threadRunRecorderKey).(*runRecorder)
+	if !ok {
+		return
+	}
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.cacheOperations = append(rec.cacheOperations, op)
+}
+
+func (rec *runRecorder) fill(result *RunResult) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	result.HTTPRequests = rec.httpRequests
+	result.CacheOperations = rec.cacheOperations
+	result.Prints = rec.prints
+}
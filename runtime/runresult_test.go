@@ -0,0 +1,134 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+)
+
+func TestRunWithResult(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(404)
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	InitCache(NewInMemoryCache())
+	InitHTTP(NewInMemoryCache())
+
+	src := fmt.Sprintf(`
+load("cache.star", "cache")
+load("http.star", "http")
+load("render.star", "render")
+
+def main():
+    http.get("%[1]s/found")
+    http.get("%[1]s/found")
+    http.get("%[1]s/missing")
+
+    if cache.get("counter") == None:
+        cache.set("counter", "1", ttl_seconds = 30)
+
+    print("hello")
+    print("world")
+    return render.Root(child=render.Box())
+`, ts.URL)
+
+	var printed []string
+	app, err := NewApplet("test.star", []byte(src), WithPrintFunc(func(_ *starlark.Thread, msg string) {
+		printed = append(printed, msg)
+	}))
+	require.NoError(t, err)
+
+	result, err := app.RunWithResult(context.Background(), nil)
+	require.NoError(t, err)
+
+	assert.Len(t, result.Roots, 1)
+	assert.Equal(t, []string{"hello", "world"}, result.Prints)
+	assert.Equal(t, []string{"hello", "world"}, printed)
+	assert.Greater(t, result.LoadDuration, time.Duration(0))
+	assert.Greater(t, result.ExecutionDuration, time.Duration(0))
+
+	require.Len(t, result.HTTPRequests, 3)
+	assert.Equal(t, "GET", result.HTTPRequests[0].Method)
+	assert.Equal(t, ts.URL+"/found", result.HTTPRequests[0].URL)
+	assert.Equal(t, 200, result.HTTPRequests[0].StatusCode)
+	assert.Equal(t, "MISS", result.HTTPRequests[0].CacheStatus)
+	assert.Equal(t, "HIT", result.HTTPRequests[1].CacheStatus)
+	assert.Equal(t, 404, result.HTTPRequests[2].StatusCode)
+
+	assert.Equal(t, []CacheOperationRecord{
+		{Operation: "get", Key: "counter"},
+		{Operation: "set", Key: "counter", TTL: 30},
+	}, result.CacheOperations)
+
+	// a second run gets a fresh record
+	result, err = app.RunWithResult(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Prints, 2)
+	assert.Equal(t, []CacheOperationRecord{
+		{Operation: "get", Key: "counter", Hit: true},
+	}, result.CacheOperations)
+}
+
+func TestRunWithResultFailure(t *testing.T) {
+	src := `
+def main():
+    print("about to fail")
+    fail("oops")
+`
+	app, err := NewApplet("test.star", []byte(src), WithPrintDisabled())
+	require.NoError(t, err)
+
+	result, err := app.RunWithResult(context.Background(), nil)
+	assert.ErrorContains(t, err, "oops")
+	require.NotNil(t, result)
+	assert.Nil(t, result.Roots)
+	assert.Equal(t, []string{"about to fail"}, result.Prints)
+}
+
+func TestRunWithResultRetries(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	InitHTTP(NewInMemoryCache())
+
+	src := fmt.Sprintf(`
+load("http.star", "http")
+load("render.star", "render")
+
+def main():
+    http.get("%s", retries = 2, backoff = 0.001)
+    return render.Root(child=render.Box())
+`, ts.URL)
+
+	app, err := NewApplet("test.star", []byte(src))
+	require.NoError(t, err)
+
+	// the 503 is cached, but the retry goes to the server anyway
+	result, err := app.RunWithResult(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, result.HTTPRequests, 2)
+	assert.Equal(t, 503, result.HTTPRequests[0].StatusCode)
+	assert.Equal(t, 0, result.HTTPRequests[0].Attempt)
+	assert.Equal(t, 200, result.HTTPRequests[1].StatusCode)
+	assert.Equal(t, 1, result.HTTPRequests[1].Attempt)
+	assert.Equal(t, 2, hits)
+}
@@ -78,13 +78,13 @@ func LoadSecretModule() (starlark.StringDict, error) {
 	return secretModule, nil
 }
 
-type decrypter func(starlark.String) (starlark.String, error)
+// decrypter returns the plaintext of a secret, or None if it's unknown.
+type decrypter func(starlark.String) (starlark.Value, error)
 
 func (sdk *SecretDecryptionKey) decrypterForApp(a *Applet) (decrypter, error) {
-	r := bytes.NewReader(sdk.EncryptedKeysetJSON)
-	kh, err := keyset.Read(keyset.NewJSONReader(r), sdk.KeyEncryptionKey)
+	kh, err := sdk.handle()
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", "reading keyset JSON", err)
+		return nil, err
 	}
 
 	dec, err := hybrid.NewHybridDecrypt(kh)
@@ -94,20 +94,24 @@ func (sdk *SecretDecryptionKey) decrypterForApp(a *Applet) (decrypter, error) {
 
 	context := []byte(a.ID)
 
-	return func(s starlark.String) (starlark.String, error) {
-		v := regexp.MustCompile(`\s`).ReplaceAllString(s.GoString(), "")
-		ciphertext, err := base64.StdEncoding.DecodeString(v)
-		if err != nil {
-			return "", fmt.Errorf("base64 decoding of secret: %s: %w", s, err)
-		}
+	return func(s starlark.String) (starlark.Value, error) {
+		return decryptSecret(dec, context, s)
+	}, nil
+}
 
-		cleartext, err := dec.Decrypt(ciphertext, context)
-		if err != nil {
-			return "", fmt.Errorf("decrypting secret %s: %w", s, err)
-		}
+func decryptSecret(dec tink.HybridDecrypt, context []byte, s starlark.String) (starlark.String, error) {
+	v := regexp.MustCompile(`\s`).ReplaceAllString(s.GoString(), "")
+	ciphertext, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return "", fmt.Errorf("base64 decoding of secret: %s: %w", s, err)
+	}
 
-		return starlark.String(cleartext), nil
-	}, nil
+	cleartext, err := dec.Decrypt(ciphertext, context)
+	if err != nil {
+		return "", fmt.Errorf("decrypting secret %s: %w", s, err)
+	}
+
+	return starlark.String(cleartext), nil
 }
 
 func (d decrypter) attachToThread(t *starlark.Thread) {
@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tidbyt.dev/pixlet/render"
+	"tidbyt.dev/pixlet/tracing"
+)
+
+func TestTracer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	InitCache(NewInMemoryCache())
+	InitHTTP(NewInMemoryCache())
+
+	src := fmt.Sprintf(`
+load("cache.star", "cache")
+load("http.star", "http")
+load("render.star", "render")
+
+def main():
+    http.get("%s/data?api_key=top_secret")
+    cache.get("counter")
+    return render.Root(child=render.Text("hi"))
+`, ts.URL)
+
+	tracer := tracing.NewTracer()
+	app, err := NewApplet("test.star", []byte(src), WithTracer(tracer))
+	require.NoError(t, err)
+
+	roots, err := app.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	roots[0].Paint(true, render.WithTracer(tracer))
+
+	spans := map[string]tracing.Event{}
+	for _, e := range tracer.Events() {
+		spans[e.Name] = e
+	}
+
+	assert.Contains(t, spans, "load")
+	assert.Equal(t, "test.star", spans["exec"].Args["file"])
+	assert.Contains(t, spans, "main")
+
+	get := spans["GET "+ts.Listener.Addr().String()]
+	assert.Equal(t, ts.URL+"/data", get.Args["url"])
+	assert.Equal(t, ts.URL+"/data", spans["httpcache.Get"].Args["url"])
+	assert.Equal(t, ts.URL+"/data", spans["RoundTrip"].Args["url"])
+	assert.Equal(t, 200, get.Args["status"])
+	assert.Equal(t, "MISS", get.Args["cache_status"])
+	assert.Equal(t, false, spans["httpcache.Get"].Args["hit"])
+	assert.Equal(t, false, spans["cache.get"].Args["hit"])
+	assert.Equal(t, "Text", spans["Text.Init"].Args["widget"])
+	assert.Equal(t, "render.Text", spans["Root.Paint"].Args["widget"])
+	assert.Equal(t, 0, spans["frame"].Args["frame"])
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/gorilla/websocket"
 	"golang.org/x/sync/errgroup"
 	"tidbyt.dev/pixlet/dist"
+	"tidbyt.dev/pixlet/runtime"
 	"tidbyt.dev/pixlet/server/fanout"
 	"tidbyt.dev/pixlet/server/loader"
 )
@@ -47,6 +48,10 @@ type previewData struct {
 	WebP  string `json:"webp"`
 	Watch bool   `json:"-"`
 	Err   string `json:"error,omitempty"`
+
+	// ErrDetails describes Err, with where it was raised in the app's
+	// source.
+	ErrDetails *runtime.AppError `json:"error_details,omitempty"`
 }
 type handlerRequest struct {
 	ID    string `json:"id"`
@@ -206,6 +211,7 @@ func (b *Browser) previewHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	if err != nil {
 		data.Err = err.Error()
+		data.ErrDetails = runtime.AsAppError(err)
 	}
 
 	d, err := json.Marshal(data)
@@ -30,6 +30,7 @@ type Loader struct {
 	maxDuration      int
 	initialLoad      chan bool
 	timeout          int
+	appletOpts       []runtime.AppletOption
 }
 
 type Update struct {
@@ -41,7 +42,9 @@ type Update struct {
 // NewLoader instantiates a new loader structure. The loader will read off of
 // fileChanges channel and write updates to the updatesChan. Updates are base64
 // encoded WebP strings. If watch is enabled, both file changes and on demand
-// requests will send updates over the updatesChan.
+// requests will send updates over the updatesChan. If cache is nil, an
+// in-memory cache is used. The HTTP client used by the applet is configured
+// with httpOpts, and the applet itself with appletOpts.
 func NewLoader(
 	fs fs.FS,
 	watch bool,
@@ -49,6 +52,9 @@ func NewLoader(
 	updatesChan chan Update,
 	maxDuration int,
 	timeout int,
+	cache runtime.Cache,
+	httpOpts []runtime.HTTPOption,
+	appletOpts []runtime.AppletOption,
 ) (*Loader, error) {
 	l := &Loader{
 		fs:               fs,
@@ -62,14 +68,17 @@ func NewLoader(
 		maxDuration:      maxDuration,
 		initialLoad:      make(chan bool),
 		timeout:          timeout,
+		appletOpts:       appletOpts,
 	}
 
-	cache := runtime.NewInMemoryCache()
-	runtime.InitHTTP(cache)
+	if cache == nil {
+		cache = runtime.NewInMemoryCache()
+	}
+	runtime.InitHTTP(cache, httpOpts...)
 	runtime.InitCache(cache)
 
 	if !l.watch {
-		app, err := loadScript("app-id", l.fs)
+		app, err := loadScript("app-id", l.fs, l.appletOpts...)
 		l.markInitialLoadComplete()
 		if err != nil {
 			return nil, err
@@ -156,7 +165,7 @@ func (l *Loader) CallSchemaHandler(ctx context.Context, handlerName, parameter s
 
 func (l *Loader) loadApplet(config map[string]string) (string, error) {
 	if l.watch {
-		app, err := loadScript("app-id", l.fs)
+		app, err := loadScript("app-id", l.fs, l.appletOpts...)
 		l.markInitialLoadComplete()
 		if err != nil {
 			return "", err
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"golang.org/x/sync/errgroup"
+	"tidbyt.dev/pixlet/runtime"
 	"tidbyt.dev/pixlet/server/browser"
 	"tidbyt.dev/pixlet/server/loader"
 	"tidbyt.dev/pixlet/tools"
@@ -22,8 +23,10 @@ type Server struct {
 	watch   bool
 }
 
-// NewServer creates a new server initialized with the applet.
-func NewServer(host string, port int, watch bool, path string, maxDuration int, timeout int) (*Server, error) {
+// NewServer creates a new server initialized with the applet. If cache is nil,
+// an in-memory cache is used. The HTTP client used by the applet is configured
+// with httpOpts.
+func NewServer(host string, port int, watch bool, path string, maxDuration int, timeout int, cache runtime.Cache, httpOpts []runtime.HTTPOption, appletOpts []runtime.AppletOption) (*Server, error) {
 	fileChanges := make(chan bool, 100)
 
 	// check if path exists, and whether it is a directory or a file
@@ -47,7 +50,7 @@ func NewServer(host string, port int, watch bool, path string, maxDuration int,
 	}
 
 	updatesChan := make(chan loader.Update, 100)
-	l, err := loader.NewLoader(fs, watch, fileChanges, updatesChan, maxDuration, timeout)
+	l, err := loader.NewLoader(fs, watch, fileChanges, updatesChan, maxDuration, timeout, cache, httpOpts, appletOpts)
 	if err != nil {
 		return nil, err
 	}
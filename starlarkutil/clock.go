@@ -0,0 +1,35 @@
+package starlarkutil
+
+import (
+	"time"
+
+	starlibtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+const (
+	// ThreadClockKey is the name of the Starlark thread-local that we use to
+	// store the thread's clock.
+	ThreadClockKey = "tidbyt.dev/pixlet/starlarkutil/$clock"
+)
+
+// AttachThreadClock makes clock the source of the current time for a
+// Starlark thread, both for `ThreadNow` and for `time.now()` in time.star.
+func AttachThreadClock(thread *starlark.Thread, clock func() time.Time) {
+	thread.SetLocal(ThreadClockKey, clock)
+	starlibtime.SetNow(thread, func() (time.Time, error) {
+		return clock(), nil
+	})
+}
+
+// ThreadNow returns the current time according to the clock that was
+// attached to a Starlark thread by `AttachThreadClock`. If no clock is
+// attached to the thread, it returns the wall-clock time.
+func ThreadNow(thread *starlark.Thread) time.Time {
+	if thread != nil {
+		if clock, ok := thread.Local(ThreadClockKey).(func() time.Time); ok {
+			return clock()
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,27 @@
+package starlarkutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	starlibtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+func TestThreadClock(t *testing.T) {
+	at := time.Date(2026, 12, 31, 23, 59, 50, 0, time.UTC)
+
+	thread := &starlark.Thread{}
+	AttachThreadClock(thread, func() time.Time { return at })
+	assert.Equal(t, at, ThreadNow(thread))
+
+	now, err := starlibtime.Now(thread)()
+	assert.NoError(t, err)
+	assert.Equal(t, at, now)
+}
+
+func TestThreadWithoutClock(t *testing.T) {
+	thread := &starlark.Thread{}
+	assert.WithinDuration(t, time.Now(), ThreadNow(thread), time.Second)
+}
@@ -0,0 +1,112 @@
+package golden
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Difference is one way in which a render differs from its snapshot.
+type Difference struct {
+	// Frame is the index of the frame that differs, or -1 if the difference
+	// is in the animation as a whole.
+	Frame int
+
+	Message string
+
+	// Diff maps the pixels of the frame, with '.' where the snapshot and
+	// render agree and 'X' where they don't. It's empty if the frames can't
+	// be compared pixel by pixel.
+	Diff []string
+}
+
+func (d Difference) String() string {
+	var sb strings.Builder
+	if d.Frame >= 0 {
+		fmt.Fprintf(&sb, "frame %d: ", d.Frame)
+	}
+	sb.WriteString(d.Message)
+
+	for _, row := range d.Diff {
+		sb.WriteString("\n")
+		sb.WriteString(row)
+	}
+
+	return sb.String()
+}
+
+// Compare returns the differences between a snapshot and a new render of
+// the same fixture. Changes to the delay or number of frames are differences
+// too.
+func Compare(expected, actual *Snapshot) []Difference {
+	var diffs []Difference
+
+	if expected.Delay != actual.Delay {
+		diffs = append(diffs, Difference{
+			Frame:   -1,
+			Message: fmt.Sprintf("delay changed from %dms to %dms", expected.Delay, actual.Delay),
+		})
+	}
+
+	if len(expected.Frames) != len(actual.Frames) {
+		diffs = append(diffs, Difference{
+			Frame:   -1,
+			Message: fmt.Sprintf("frame count changed from %d to %d", len(expected.Frames), len(actual.Frames)),
+		})
+	}
+
+	for i := 0; i < len(expected.Frames) && i < len(actual.Frames); i++ {
+		if d, ok := compareFrames(expected.Frames[i], actual.Frames[i]); !ok {
+			d.Frame = i
+			diffs = append(diffs, d)
+		}
+	}
+
+	return diffs
+}
+
+func compareFrames(expected, actual image.Image) (Difference, bool) {
+	eb, ab := expected.Bounds(), actual.Bounds()
+	if eb.Dx() != ab.Dx() || eb.Dy() != ab.Dy() {
+		return Difference{
+			Message: fmt.Sprintf(
+				"size changed from %dx%d to %dx%d",
+				eb.Dx(), eb.Dy(), ab.Dx(), ab.Dy()),
+		}, false
+	}
+
+	var (
+		diff  []string
+		count int
+		first string
+	)
+
+	for y := 0; y < eb.Dy(); y++ {
+		row := make([]byte, eb.Dx())
+		for x := 0; x < eb.Dx(); x++ {
+			e := toRGBA(expected.At(eb.Min.X+x, eb.Min.Y+y))
+			a := toRGBA(actual.At(ab.Min.X+x, ab.Min.Y+y))
+
+			if e == a {
+				row[x] = '.'
+				continue
+			}
+
+			row[x] = 'X'
+			if count == 0 {
+				first = fmt.Sprintf("%d,%d: expected %s, found %s", x, y, hexColor(e), hexColor(a))
+			}
+			count++
+		}
+		diff = append(diff, string(row))
+	}
+
+	if count == 0 {
+		return Difference{}, true
+	}
+
+	return Difference{
+		Message: fmt.Sprintf("%d pixels differ, first at %s", count, first),
+		Diff:    diff,
+	}, false
+}
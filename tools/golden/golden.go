@@ -0,0 +1,344 @@
+// Package golden stores rendered app frames as snapshots on disk, and
+// compares later renders against them.
+package golden
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tidbyt.dev/pixlet/encode"
+	"tidbyt.dev/pixlet/render"
+)
+
+// Format is the on-disk format of snapshot frames.
+type Format string
+
+const (
+	// FormatPNG stores each frame as a PNG image.
+	FormatPNG Format = "png"
+
+	// FormatASCII stores each frame as rows of characters, one per pixel, as
+	// used by render.ImageChecker. Only colors in render.DefaultPalette can be
+	// stored this way.
+	FormatASCII Format = "ascii"
+)
+
+const (
+	// DefaultFixture is the name of the fixture used for apps that don't
+	// define any.
+	DefaultFixture = "default"
+
+	snapshotFile = "snapshot.json"
+)
+
+// ErrNoSnapshot is returned when loading a snapshot that hasn't been written
+// yet.
+var ErrNoSnapshot = errors.New("no snapshot")
+
+// Fixture is a named config to render an app with.
+type Fixture struct {
+	Name string `json:"-"`
+
+	Config map[string]string `json:"config"`
+
+	// At is the time the app is rendered at. If zero, the app runs with
+	// the real time.
+	At time.Time `json:"at"`
+}
+
+// Snapshot is an app's rendered output.
+type Snapshot struct {
+	// Delay is the delay between frames, in milliseconds.
+	Delay  int32
+	Frames []image.Image
+}
+
+// SnapshotFromRoots paints roots into a snapshot.
+func SnapshotFromRoots(roots []render.Root) *Snapshot {
+	snap := &Snapshot{
+		Delay:  encode.DefaultScreenDelayMillis,
+		Frames: render.PaintRoots(true, roots...),
+	}
+
+	if len(roots) > 0 && roots[0].Delay > 0 {
+		snap.Delay = roots[0].Delay
+	}
+
+	return snap
+}
+
+// Store reads and writes the fixtures and snapshots of a single app, all of
+// which live in one directory:
+//
+//	<name>.json              a fixture
+//	<name>/snapshot.json     the snapshot's frame count, delay and format
+//	<name>/frame_000.png     frames, in PNG or ASCII (.txt) format
+type Store struct {
+	Dir string
+
+	// Format is the format new snapshots are saved in. Existing snapshots
+	// are loaded in whatever format they were saved in.
+	Format Format
+}
+
+type snapshotMeta struct {
+	Frames int    `json:"frames"`
+	Delay  int32  `json:"delay_ms"`
+	Format Format `json:"format"`
+}
+
+// Fixtures returns the fixtures in the store, sorted by name. If there are
+// none, a single fixture named DefaultFixture with empty config is returned.
+func (s *Store) Fixtures() ([]Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var fixtures []Fixture
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading fixture: %w", err)
+		}
+
+		f := Fixture{}
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("parsing fixture %s: %w", path, err)
+		}
+		f.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+
+		fixtures = append(fixtures, f)
+	}
+
+	if len(fixtures) == 0 {
+		fixtures = append(fixtures, Fixture{Name: DefaultFixture})
+	}
+
+	return fixtures, nil
+}
+
+// Load reads the snapshot for the named fixture. If there is none,
+// ErrNoSnapshot is returned.
+func (s *Store) Load(name string) (*Snapshot, error) {
+	dir := filepath.Join(s.Dir, name)
+
+	b, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoSnapshot
+	} else if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	meta := snapshotMeta{}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("parsing snapshot %s: %w", dir, err)
+	}
+
+	snap := &Snapshot{Delay: meta.Delay}
+	for i := 0; i < meta.Frames; i++ {
+		path := filepath.Join(dir, frameFile(i, meta.Format))
+
+		var im image.Image
+		switch meta.Format {
+		case FormatPNG:
+			im, err = readPNG(path)
+		case FormatASCII:
+			im, err = readASCII(path)
+		default:
+			err = fmt.Errorf("unknown format: %q", meta.Format)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading frame %d of %s: %w", i, dir, err)
+		}
+
+		snap.Frames = append(snap.Frames, im)
+	}
+
+	return snap, nil
+}
+
+// Save writes the snapshot for the named fixture, replacing any existing one.
+func (s *Store) Save(name string, snap *Snapshot) error {
+	format := s.Format
+	if format == "" {
+		format = FormatPNG
+	}
+
+	dir := filepath.Join(s.Dir, name)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("removing old snapshot: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating snapshot directory: %w", err)
+	}
+
+	for i, im := range snap.Frames {
+		path := filepath.Join(dir, frameFile(i, format))
+
+		var err error
+		switch format {
+		case FormatPNG:
+			err = writePNG(path, im)
+		case FormatASCII:
+			err = writeASCII(path, im)
+		default:
+			err = fmt.Errorf("unknown format: %q", format)
+		}
+		if err != nil {
+			return fmt.Errorf("writing frame %d: %w", i, err)
+		}
+	}
+
+	b, err := json.MarshalIndent(snapshotMeta{
+		Frames: len(snap.Frames),
+		Delay:  snap.Delay,
+		Format: format,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, snapshotFile), append(b, '\n'), 0644)
+}
+
+func frameFile(i int, format Format) string {
+	ext := "png"
+	if format == FormatASCII {
+		ext = "txt"
+	}
+	return fmt.Sprintf("frame_%03d.%s", i, ext)
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+func writePNG(path string, im image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, im); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func readASCII(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rows = append(rows, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ParseASCII(rows)
+}
+
+func writeASCII(path string, im image.Image) error {
+	rows, err := FormatASCIIRows(im)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(rows, "\n")+"\n"), 0644)
+}
+
+// ParseASCII builds an image from rows of characters in
+// render.DefaultPalette.
+func ParseASCII(rows []string) (image.Image, error) {
+	width := 0
+	if len(rows) > 0 {
+		width = len(rows[0])
+	}
+
+	im := image.NewRGBA(image.Rect(0, 0, width, len(rows)))
+	for y, row := range rows {
+		if len(row) != width {
+			return nil, fmt.Errorf("row %d: expected %d columns, found %d", y, width, len(row))
+		}
+
+		for x, c := range row {
+			rgba, ok := render.DefaultPalette[string(c)]
+			if !ok {
+				return nil, fmt.Errorf("row %d: unknown color %q", y, c)
+			}
+			im.SetRGBA(x, y, rgba)
+		}
+	}
+
+	return im, nil
+}
+
+// FormatASCIIRows is the inverse of ParseASCII. It fails if the image has
+// colors that aren't in render.DefaultPalette.
+func FormatASCIIRows(im image.Image) ([]string, error) {
+	ascii := map[color.RGBA]rune{}
+	for c, rgba := range render.DefaultPalette {
+		ascii[rgba] = rune(c[0])
+	}
+
+	b := im.Bounds()
+	rows := make([]string, 0, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := make([]rune, 0, b.Dx())
+		for x := b.Min.X; x < b.Max.X; x++ {
+			rgba := toRGBA(im.At(x, y))
+			c, ok := ascii[rgba]
+			if !ok {
+				return nil, fmt.Errorf(
+					"color %s at %d,%d is not in the ASCII palette, use PNG snapshots instead",
+					hexColor(rgba), x, y)
+			}
+			row = append(row, c)
+		}
+		rows = append(rows, string(row))
+	}
+
+	return rows, nil
+}
+
+// toRGBA converts c to non-premultiplied RGBA, the way colors are written in
+// render.DefaultPalette.
+func toRGBA(c color.Color) color.RGBA {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 0 {
+		return color.RGBA{}
+	}
+	return color.RGBA{n.R, n.G, n.B, n.A}
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
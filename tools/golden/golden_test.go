@@ -0,0 +1,120 @@
+package golden
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func frame(t *testing.T, rows ...string) image.Image {
+	im, err := ParseASCII(rows)
+	require.NoError(t, err)
+	return im
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatPNG, FormatASCII} {
+		t.Run(string(format), func(t *testing.T) {
+			store := &Store{Dir: t.TempDir(), Format: format}
+
+			_, err := store.Load("default")
+			assert.ErrorIs(t, err, ErrNoSnapshot)
+
+			snap := &Snapshot{
+				Delay: 100,
+				Frames: []image.Image{
+					frame(t, "rg.", "bwx"),
+					frame(t, "xxx", "xxr"),
+				},
+			}
+			require.NoError(t, store.Save("default", snap))
+
+			loaded, err := store.Load("default")
+			require.NoError(t, err)
+			assert.Equal(t, int32(100), loaded.Delay)
+			assert.Len(t, loaded.Frames, 2)
+			assert.Empty(t, Compare(snap, loaded))
+		})
+	}
+}
+
+func TestStoreSaveReplaces(t *testing.T) {
+	store := &Store{Dir: t.TempDir(), Format: FormatPNG}
+	require.NoError(t, store.Save("f", &Snapshot{Delay: 50, Frames: []image.Image{
+		frame(t, "r"), frame(t, "g"), frame(t, "b"),
+	}}))
+
+	store.Format = FormatASCII
+	require.NoError(t, store.Save("f", &Snapshot{Delay: 50, Frames: []image.Image{
+		frame(t, "w"),
+	}}))
+
+	entries, err := os.ReadDir(filepath.Join(store.Dir, "f"))
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"frame_000.txt", "snapshot.json"}, names)
+}
+
+func TestASCIIRejectsUnknownColors(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	im.Set(1, 0, color.RGBA{0x12, 0x34, 0x56, 0xff})
+
+	_, err := FormatASCIIRows(im)
+	assert.ErrorContains(t, err, "color #123456ff at 1,0 is not in the ASCII palette")
+}
+
+func TestFixtures(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+
+	fixtures, err := store.Fixtures()
+	require.NoError(t, err)
+	assert.Equal(t, []Fixture{{Name: DefaultFixture}}, fixtures)
+
+	require.NoError(t, os.WriteFile(
+		filepath.Join(store.Dir, "metric.json"),
+		[]byte(`{"config": {"units": "metric"}, "at": "2024-01-02T03:04:05Z"}`),
+		0644,
+	))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(store.Dir, "imperial.json"),
+		[]byte(`{"config": {"units": "imperial"}}`),
+		0644,
+	))
+
+	fixtures, err = store.Fixtures()
+	require.NoError(t, err)
+	assert.Equal(t, []Fixture{
+		{Name: "imperial", Config: map[string]string{"units": "imperial"}},
+		{Name: "metric", Config: map[string]string{"units": "metric"}, At: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}, fixtures)
+}
+
+func TestCompare(t *testing.T) {
+	expected := &Snapshot{Delay: 50, Frames: []image.Image{
+		frame(t, "rr", "gg"),
+		frame(t, "bb", "ww"),
+	}}
+
+	assert.Empty(t, Compare(expected, expected))
+
+	diffs := Compare(expected, &Snapshot{Delay: 100, Frames: []image.Image{
+		frame(t, "rr", "gx"),
+		frame(t, "bbb", "www"),
+		frame(t, "xx", "xx"),
+	}})
+
+	require.Len(t, diffs, 4)
+	assert.Equal(t, "delay changed from 50ms to 100ms", diffs[0].String())
+	assert.Equal(t, "frame count changed from 2 to 3", diffs[1].String())
+	assert.Equal(t, "frame 0: 1 pixels differ, first at 1,1: expected #00ff00ff, found #000000ff\n..\n.X", diffs[2].String())
+	assert.Equal(t, "frame 1: size changed from 2x2 to 3x2", diffs[3].String())
+}
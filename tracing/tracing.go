@@ -0,0 +1,178 @@
+// Package tracing records spans of work done while running and rendering
+// apps, and writes them as Chrome trace events, which can be opened in
+// Perfetto (https://ui.perfetto.dev) or chrome://tracing.
+//
+// Tracing is off unless a Tracer is created. All methods can be called on a
+// nil Tracer or Span, and do nothing, so that code doesn't need to check
+// whether it's being traced.
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MainThread is the thread that spans are recorded on by Start. Spans that
+// run in parallel, like the frames of an animation, are recorded on other
+// threads with StartOnThread, so that they're shown side by side.
+const MainThread = 1
+
+// Event is a Chrome trace event. Spans are recorded as complete events,
+// with phase X, and times in microseconds since the tracer was created.
+type Event struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat"`
+	Phase     string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	Duration  float64                `json:"dur"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// Tracer records spans.
+type Tracer struct {
+	mutex  sync.Mutex
+	start  time.Time
+	events []Event
+}
+
+// NewTracer returns a tracer that records spans from now on.
+func NewTracer() *Tracer {
+	return &Tracer{start: time.Now()}
+}
+
+// Start starts a span on the main thread. category groups related spans,
+// e.g. http or render.
+func (t *Tracer) Start(category, name string) *Span {
+	return t.StartOnThread(MainThread, category, name)
+}
+
+// StartOnThread starts a span on thread tid.
+func (t *Tracer) StartOnThread(tid int, category, name string) *Span {
+	if t == nil {
+		return nil
+	}
+
+	return &Span{
+		tracer: t,
+		start:  time.Now(),
+		event: Event{
+			Name:     name,
+			Category: category,
+			Phase:    "X",
+			PID:      1,
+			TID:      tid,
+		},
+	}
+}
+
+// Events returns the spans that have ended so far.
+func (t *Tracer) Events() []Event {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]Event{}, t.events...)
+}
+
+// WriteJSON writes the recorded spans in the Chrome trace event format.
+func (t *Tracer) WriteJSON(w io.Writer) error {
+	trace := struct {
+		TraceEvents     []Event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{
+		TraceEvents:     t.Events(),
+		DisplayTimeUnit: "ms",
+	}
+
+	if trace.TraceEvents == nil {
+		trace.TraceEvents = []Event{}
+	}
+
+	return json.NewEncoder(w).Encode(trace)
+}
+
+func (t *Tracer) record(e Event) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.events = append(t.events, e)
+}
+
+// Span is a piece of work being traced.
+type Span struct {
+	tracer *Tracer
+	start  time.Time
+	event  Event
+}
+
+// SetAttr sets an attribute of the span, which is shown with it in trace
+// viewers. It returns the span, so that calls can be chained.
+func (s *Span) SetAttr(key string, value interface{}) *Span {
+	if s == nil {
+		return nil
+	}
+
+	if s.event.Args == nil {
+		s.event.Args = map[string]interface{}{}
+	}
+	s.event.Args[key] = value
+
+	return s
+}
+
+// SetURL sets the url attribute of the span to u, without its user info,
+// query string or fragment. Traces are meant to be shared, and those often
+// hold credentials such as API keys.
+func (s *Span) SetURL(u *url.URL) *Span {
+	if s == nil || u == nil {
+		return s
+	}
+
+	return s.SetAttr("url", (&url.URL{
+		Scheme:  u.Scheme,
+		Host:    u.Host,
+		Path:    u.Path,
+		RawPath: u.RawPath,
+	}).String())
+}
+
+// End ends the span, and records it.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.event.Timestamp = micros(s.start.Sub(s.tracer.start))
+	s.event.Duration = micros(time.Since(s.start))
+	s.tracer.record(s.event)
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e3
+}
+
+type tracerContextKey struct{}
+
+// NewContext returns a copy of ctx that carries t.
+func NewContext(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerContextKey{}, t)
+}
+
+// FromContext returns the tracer carried by ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Tracer {
+	if ctx == nil {
+		return nil
+	}
+
+	t, _ := ctx.Value(tracerContextKey{}).(*Tracer)
+	return t
+}